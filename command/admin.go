@@ -0,0 +1,60 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package command
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+)
+
+var restart bool
+
+func addAdminCommands(cmd *cobra.Command) {
+	adminCmd := &cobra.Command{
+		Use: "admin",
+		Run: helpFn,
+	}
+	reindexCmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "rebuild the index of gists from the repositories, an interrupted run is resumed",
+		Long: `Rebuild the index of gists from the repositories, an interrupted run is resumed.
+The server holds the index while it runs, stop it before reindexing.
+The server also rebuilds the index at start when the index is outdated.`,
+		Run: wrapRunFn(reindex),
+	}
+	reindexCmd.Flags().BoolVar(&restart, "restart", false, "start over instead of resuming an interrupted run")
+	adminCmd.AddCommand(reindexCmd)
+	cmd.AddCommand(adminCmd)
+}
+
+func reindex(cmd *cobra.Command, c config.Config, args []string) {
+	idx, err := index.Open(c)
+	if err != nil {
+		log.Fatalf("%v, stop the server before reindexing", err)
+	}
+	defer idx.Close()
+	err = idx.Reindex(repo.New(c), restart, func(done, total int, id string) {
+		fmt.Printf("[%d/%d] %s\n", done, total, id)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("done")
+}
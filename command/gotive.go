@@ -45,6 +45,8 @@ func newRootCmd() *cobra.Command {
 
 func addCommands(cmd *cobra.Command) {
 	addServerCommands(cmd)
+	addUserCommands(cmd)
+	addAdminCommands(cmd)
 }
 
 func helpFn(cmd *cobra.Command, args []string) { cmd.Help() }
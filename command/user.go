@@ -0,0 +1,95 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package command
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/user"
+	"golang.org/x/crypto/ssh/terminal"
+	"io/ioutil"
+	"os"
+)
+
+func addUserCommands(cmd *cobra.Command) {
+	userCmd := &cobra.Command{
+		Use: "user",
+		Run: helpFn,
+	}
+	userCmd.AddCommand(&cobra.Command{
+		Use:   "add <name> <email>",
+		Short: "register a user, the password is read from the terminal",
+		Run:   wrapRunFn(addUser),
+	})
+	userCmd.AddCommand(&cobra.Command{
+		Use:   "key <name> <public key file>",
+		Short: "register a ssh public key of the user",
+		Run:   wrapRunFn(addKey),
+	})
+	cmd.AddCommand(userCmd)
+}
+
+func addUser(cmd *cobra.Command, c config.Config, args []string) {
+	if len(args) != 2 {
+		cmd.Usage()
+		return
+	}
+	users := user.New(c)
+	if _, err := users.Find(args[0]); err == nil {
+		log.Fatalf("%s already exists", args[0])
+	}
+
+	fmt.Print("Password: ")
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	u := &user.User{Name: args[0], Email: args[1]}
+	if err := u.SetPassword(string(password)); err != nil {
+		log.Fatal(err)
+	}
+	if err := users.Create(u); err == user.UserExists {
+		log.Fatalf("%s already exists", args[0])
+	} else if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func addKey(cmd *cobra.Command, c config.Config, args []string) {
+	if len(args) != 2 {
+		cmd.Usage()
+		return
+	}
+	users := user.New(c)
+	u, err := users.Find(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := u.AddKey(b); err != nil {
+		log.Fatal(err)
+	}
+	if err := users.Save(u); err != nil {
+		log.Fatal(err)
+	}
+}
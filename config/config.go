@@ -26,24 +26,81 @@ type commitDefaults struct {
 	Email string `toml:"email"`
 }
 
+// oidcConfig enables the single sign-on through an OpenID Connect provider when Issuer is given.
+type oidcConfig struct {
+	Issuer       string   `toml:"issuer"`
+	ClientId     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"`
+	RedirectURL  string   `toml:"redirect_url"` // e.g. http://gist.example.com/login/sso/callback
+	Scopes       []string `toml:"scopes"`
+	NameClaim    string   `toml:"name_claim"`
+	EmailClaim   string   `toml:"email_claim"`
+}
+
+// ldapConfig authenticates users against a directory server when URL is given.
+type ldapConfig struct {
+	URL                string `toml:"url"` // ldap://host:389 or ldaps://host:636
+	StartTLS           bool   `toml:"start_tls"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+	// CAFile is the PEM file of the CA which signs the directory server, the system roots when empty.
+	CAFile string `toml:"ca_file"`
+	// BindDN and BindPassword are the service account to search users, anonymous when empty.
+	BindDN       string `toml:"bind_dn"`
+	BindPassword string `toml:"bind_password"`
+	BaseDN       string `toml:"base_dn"`
+	UserFilter   string `toml:"user_filter"` // %s is replaced with the escaped login name
+	NameAttr     string `toml:"name_attr"`
+	EmailAttr    string `toml:"email_attr"`
+	GroupAttr    string `toml:"group_attr"`
+	// Roles maps group DNs to gotive roles.
+	Roles map[string]string `toml:"roles"`
+}
+
 type gotiveConfig struct {
-	Port   uint           `toml:"port"`
-	Repo   string         `toml:"repo"`
-	Git    string         `toml:"git"`
-	Commit commitDefaults `toml:"commit_defaults"`
+	// URL is where users reach gotive, e.g. https://gist.example.com, cookies are sent only over https when it is.
+	URL     string         `toml:"url"`
+	Port    uint           `toml:"port"`
+	SshPort uint           `toml:"ssh_port"`
+	HostKey string         `toml:"host_key"`
+	Repo    string         `toml:"repo"`
+	Users   string         `toml:"users"`
+	Tokens  string         `toml:"tokens"`
+	Orgs    string         `toml:"orgs"`
+	Index   string         `toml:"index"`
+	Secret  string         `toml:"secret"`
+	Git     string         `toml:"git"`
+	Commit  commitDefaults `toml:"commit_defaults"`
+	OIDC    oidcConfig     `toml:"oidc"`
+	LDAP    ldapConfig     `toml:"ldap"`
 }
 
 type Config *gotiveConfig
 
 func New() Config {
 	return &gotiveConfig{
-		Port: 8080,
-		Repo: "./repo",
-		Git:  "git",
+		Port:    8080,
+		HostKey: "./ssh_host_key",
+		Repo:    "./repo",
+		Users:   "./users",
+		Tokens:  "./tokens",
+		Orgs:    "./orgs",
+		Index:   "./index.db",
+		Git:     "git",
 		Commit: commitDefaults{
 			Name:  "anonymous",
 			Email: "anonymous@example.com",
 		},
+		OIDC: oidcConfig{
+			Scopes:     []string{"openid", "profile", "email"},
+			NameClaim:  "preferred_username",
+			EmailClaim: "email",
+		},
+		LDAP: ldapConfig{
+			UserFilter: "(uid=%s)",
+			NameAttr:   "uid",
+			EmailAttr:  "mail",
+			GroupAttr:  "memberOf",
+		},
 	}
 }
 
@@ -0,0 +1,205 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package acl
+
+import (
+	"fmt"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/user"
+	"strings"
+)
+
+// NotFound is returned for missing gists and for gists hidden from the user alike,
+// so nobody learns that a private gist exists.
+var NotFound = fmt.Errorf("Gist not found")
+
+// ACL is the authorization layer, every access to gists on behalf of a user goes through it.
+type ACL interface {
+	// Load returns the gist id only if u may read it, u is nil for anonymous.
+	Load(u *user.User, id string) (repo.Repo, error)
+	Readable(u *user.User, r repo.Repo) (bool, error)
+	Writable(u *user.User, r repo.Repo) (bool, error)
+	// Manageable reports whether u may delete r and decide who accesses it.
+	Manageable(u *user.User, r repo.Repo) (bool, error)
+}
+
+type gotiveACL struct {
+	config config.Config
+}
+
+func New(c config.Config) ACL {
+	return &gotiveACL{c}
+}
+
+func (a *gotiveACL) Load(u *user.User, id string) (repo.Repo, error) {
+	r, err := repo.New(a.config).LoadRepo(id)
+	if err != nil {
+		log.Debug(err)
+		return nil, NotFound
+	}
+	if ok, err := a.Readable(u, r); err != nil {
+		return nil, err
+	} else if ok == false {
+		return nil, NotFound
+	}
+	return r, nil
+}
+
+// Readable reports whether u may read r. Public and secret gists are open to everyone,
+// private ones only to those who may write and the readers.
+func (a *gotiveACL) Readable(u *user.User, r repo.Repo) (bool, error) {
+	v, err := r.Visibility()
+	if err != nil {
+		return false, err
+	}
+	if v != repo.Private {
+		return true, nil
+	}
+	if u == nil {
+		return false, nil
+	}
+	if ok, err := a.Writable(u, r); err != nil || ok {
+		return ok, err
+	}
+	readers, err := r.Readers()
+	if err != nil {
+		return false, err
+	}
+	return a.granted(u, readers)
+}
+
+// Writable reports whether u may change r, that is who manages it, a member of
+// the organization which owns it or a writer. Anonymous visitors never write.
+func (a *gotiveACL) Writable(u *user.User, r repo.Repo) (bool, error) {
+	if ok, err := a.Manageable(u, r); err != nil || ok {
+		return ok, err
+	}
+	if u == nil {
+		return false, nil
+	}
+	owner, err := r.Owner()
+	if err != nil {
+		return false, err
+	}
+	if name, ok := org.ParseOwner(owner); ok {
+		o, err := a.org(name)
+		if err != nil {
+			return false, err
+		}
+		if o != nil && o.IsMember(u.Name) {
+			return true, nil
+		}
+	}
+	writers, err := r.Writers()
+	if err != nil {
+		return false, err
+	}
+	return a.granted(u, writers)
+}
+
+// Manageable reports whether u is the owner of r, or an admin of the organization which owns it.
+// Gists made before owners existed have none, only admins manage them.
+func (a *gotiveACL) Manageable(u *user.User, r repo.Repo) (bool, error) {
+	if u == nil {
+		return false, nil
+	}
+	owner, err := r.Owner()
+	if err != nil {
+		return false, err
+	}
+	if len(owner) < 1 {
+		return u.HasRole(user.AdminRole), nil
+	}
+	if name, ok := org.ParseOwner(owner); ok {
+		o, err := a.org(name)
+		return o != nil && o.IsAdmin(u.Name), err
+	}
+	return u.Name == owner, nil
+}
+
+// org finds the organization, nil means it does not exist any more.
+func (a *gotiveACL) org(name string) (*org.Org, error) {
+	o, err := org.New(a.config).Find(name)
+	if err == org.OrgNotFound {
+		return nil, nil
+	}
+	return o, err
+}
+
+// granted reports whether one of the entries names u or a team of u.
+// Teams are groups of the directory server, or teams of organizations as <org>/<team>.
+func (a *gotiveACL) granted(u *user.User, entries []string) (bool, error) {
+	for _, e := range entries {
+		kv := strings.SplitN(e, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "user":
+			if kv[1] == u.Name {
+				return true, nil
+			}
+		case "team":
+			for _, g := range u.Groups {
+				if kv[1] == g {
+					return true, nil
+				}
+			}
+			if name, team, ok := org.ParseTeam(kv[1]); ok {
+				o, err := a.org(name)
+				if err != nil {
+					return false, err
+				}
+				if o != nil && o.InTeam(team, u.Name) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// ParseEntries reads an entry per line, a bare name is a user. Lines are used
+// because team names may be distinguished names which contain commas.
+func ParseEntries(s string) ([]string, error) {
+	entries := []string{}
+	for _, e := range strings.Split(s, "\n") {
+		if e = strings.TrimSpace(e); len(e) < 1 {
+			continue
+		}
+		kv := strings.SplitN(e, ":", 2)
+		if len(kv) == 1 {
+			kv = []string{"user", e}
+		}
+		switch kv[0] {
+		case "user":
+			if user.ValidName(kv[1]) == false {
+				return nil, fmt.Errorf("Unsupported user name %s", kv[1])
+			}
+		case "team":
+			if len(kv[1]) < 1 {
+				return nil, fmt.Errorf("Empty team name")
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported entry %s", e)
+		}
+		entries = append(entries, kv[0]+":"+kv[1])
+	}
+	return entries, nil
+}
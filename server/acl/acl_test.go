@@ -0,0 +1,191 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package acl_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+)
+
+var _ = Describe("ACL", func() {
+	var (
+		c    config.Config
+		a    ACL
+		r    repo.Repo
+		root string
+
+		owner  = &user.User{Name: "owner"}
+		reader = &user.User{Name: "reader"}
+		member = &user.User{Name: "member", Groups: []string{"cn=dev,ou=groups"}}
+		other  = &user.User{Name: "other"}
+	)
+	BeforeEach(func() {
+		c = config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "acl")
+		Expect(err).To(BeNil())
+		root = p
+		c.Repo = p
+		o, err := ioutil.TempDir(os.TempDir(), "orgs")
+		Expect(err).To(BeNil())
+		c.Orgs = o
+		a = New(c)
+		r, err = repo.New(c).MakeRepo()
+		Expect(err).To(BeNil())
+		Expect(r.ApplyOwner("owner")).To(BeNil())
+	})
+	AfterEach(func() {
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+		Expect(osutil.ForceRemoveAll(c.Orgs)).To(BeNil())
+	})
+
+	readable := func(u *user.User) bool {
+		ok, err := a.Readable(u, r)
+		Expect(err).To(BeNil())
+		return ok
+	}
+
+	It("open public and secret gists to everyone", func() {
+		for _, v := range []repo.Visibility{repo.Public, repo.Secret} {
+			Expect(r.ApplyVisibility(v)).To(BeNil())
+			Expect(readable(nil)).To(BeTrue())
+			Expect(readable(other)).To(BeTrue())
+		}
+	})
+
+	It("open private gists to the owner and the readers", func() {
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		Expect(r.ApplyReaders([]string{"user:reader", "team:cn=dev,ou=groups"})).To(BeNil())
+		Expect(readable(nil)).To(BeFalse())
+		Expect(readable(other)).To(BeFalse())
+		Expect(readable(owner)).To(BeTrue())
+		Expect(readable(reader)).To(BeTrue())
+		Expect(readable(member)).To(BeTrue())
+	})
+
+	It("hide private gists as missing ones", func() {
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		_, err := a.Load(other, r.Id())
+		Expect(err).To(Equal(NotFound))
+		_, err = a.Load(other, "missing")
+		Expect(err).To(Equal(NotFound))
+
+		found, err := a.Load(owner, r.Id())
+		Expect(err).To(BeNil())
+		Expect(found.Id()).To(Equal(r.Id()))
+	})
+
+	It("let the owner and the writers write", func() {
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		Expect(r.ApplyReaders([]string{"user:reader"})).To(BeNil())
+		Expect(r.ApplyWriters([]string{"team:cn=dev,ou=groups"})).To(BeNil())
+		for u, want := range map[*user.User]bool{owner: true, member: true, reader: false, other: false} {
+			ok, err := a.Writable(u, r)
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(want))
+		}
+		ok, err := a.Writable(nil, r)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+
+		// writers read private gists too
+		Expect(readable(member)).To(BeTrue())
+	})
+
+	It("let only the owner manage", func() {
+		Expect(r.ApplyWriters([]string{"user:member"})).To(BeNil())
+		for u, want := range map[*user.User]bool{owner: true, member: false, other: false} {
+			ok, err := a.Manageable(u, r)
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(want))
+		}
+	})
+
+	It("let only admins write gists without owner", func() {
+		Expect(r.ApplyOwner("")).To(BeNil())
+		admin := &user.User{Name: "admin", Roles: []string{user.AdminRole}}
+		for u, want := range map[*user.User]bool{admin: true, owner: false, other: false} {
+			ok, err := a.Manageable(u, r)
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(want))
+			ok, err = a.Writable(u, r)
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(want))
+		}
+		ok, err := a.Manageable(nil, r)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+		ok, err = a.Writable(nil, r)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("let organizations own gists", func() {
+		Expect(org.New(c).Save(&org.Org{
+			Name:    "acme",
+			Admins:  []string{"owner"},
+			Members: []string{"member", "reader"},
+			Teams:   map[string][]string{"ops": {"reader"}},
+		})).To(BeNil())
+		o, err := org.New(c).Find("acme")
+		Expect(err).To(BeNil())
+		Expect(r.ApplyOwner(o.Owner())).To(BeNil())
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+
+		ok, err := a.Manageable(owner, r)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		ok, err = a.Manageable(member, r)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+		ok, err = a.Writable(member, r)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		Expect(readable(member)).To(BeTrue())
+		Expect(readable(other)).To(BeFalse())
+	})
+
+	It("grant access to teams of organizations", func() {
+		Expect(org.New(c).Save(&org.Org{
+			Name:    "acme",
+			Admins:  []string{"admin"},
+			Members: []string{"reader"},
+			Teams:   map[string][]string{"ops": {"reader"}},
+		})).To(BeNil())
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		Expect(r.ApplyReaders([]string{"team:acme/ops"})).To(BeNil())
+		Expect(readable(reader)).To(BeTrue())
+		Expect(readable(other)).To(BeFalse())
+	})
+
+	It("parse entries per line", func() {
+		entries, err := ParseEntries("way\n team:cn=dev,ou=groups \n\nuser:moge\n")
+		Expect(err).To(BeNil())
+		Expect(entries).To(Equal([]string{"user:way", "team:cn=dev,ou=groups", "user:moge"}))
+
+		_, err = ParseEntries("group:dev")
+		Expect(err).NotTo(BeNil())
+		_, err = ParseEntries("user:bad name")
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,40 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package auth
+
+import (
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/user"
+)
+
+// Authenticator checks the name and password of a user.
+// It returns user.FailToAuthenticate when they are wrong.
+type Authenticator interface {
+	Authenticate(name, password string) (*user.User, error)
+}
+
+// New returns the authenticator configured in c, the local user store is used by default.
+func New(c config.Config) Authenticator {
+	if External(c) {
+		return NewLDAP(c, DialLDAP)
+	}
+	return user.New(c)
+}
+
+// External reports whether passwords are managed outside of gotive, so local signup is disabled.
+func External(c config.Config) bool {
+	return 0 < len(c.LDAP.URL)
+}
@@ -0,0 +1,168 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/user"
+	"io/ioutil"
+	"net/url"
+)
+
+// LDAPConn is the part of the directory connection which gotive uses.
+type LDAPConn interface {
+	StartTLS(config *tls.Config) error
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPDialer opens a connection to the directory server.
+type LDAPDialer func(c config.Config) (LDAPConn, error)
+
+// DialLDAP connects to the url of the configuration, ldaps:// is verified like StartTLS.
+func DialLDAP(c config.Config) (LDAPConn, error) {
+	cfg, err := tlsConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return ldap.DialURL(c.LDAP.URL, ldap.DialWithTLSConfig(cfg))
+}
+
+// tlsConfig verifies the directory server by the CA file of the configuration, or by the system roots.
+func tlsConfig(c config.Config) (*tls.Config, error) {
+	u, err := url.Parse(c.LDAP.URL)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: c.LDAP.InsecureSkipVerify}
+	if 0 < len(c.LDAP.CAFile) {
+		pem, err := ioutil.ReadFile(c.LDAP.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if cfg.RootCAs.AppendCertsFromPEM(pem) == false {
+			return nil, fmt.Errorf("No certificates in %s", c.LDAP.CAFile)
+		}
+	}
+	return cfg, nil
+}
+
+type ldapAuthenticator struct {
+	config config.Config
+	users  user.Users
+	dial   LDAPDialer
+}
+
+// NewLDAP returns the authenticator which binds as the user found by the search filter.
+// Users are kept in the local store to own gists, their passwords are never stored.
+func NewLDAP(c config.Config, dial LDAPDialer) Authenticator {
+	return &ldapAuthenticator{c, user.New(c), dial}
+}
+
+func (a *ldapAuthenticator) Authenticate(name, password string) (*user.User, error) {
+	// an empty password means an unauthenticated bind, which many servers accept
+	if len(name) < 1 || len(password) < 1 {
+		return nil, user.FailToAuthenticate
+	}
+	c := a.config.LDAP
+	conn, err := a.dial(a.config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if c.StartTLS {
+		cfg, err := tlsConfig(a.config)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.StartTLS(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if 0 < len(c.BindDN) {
+		if err := conn.Bind(c.BindDN, c.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	req := ldap.NewSearchRequest(c.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(c.UserFilter, ldap.EscapeFilter(name)),
+		[]string{c.NameAttr, c.EmailAttr, c.GroupAttr}, nil)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		log.Debugf("%d entries are found for %s", len(res.Entries), name)
+		return nil, user.FailToAuthenticate
+	}
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, user.FailToAuthenticate
+		}
+		return nil, err
+	}
+	return a.save(entry)
+}
+
+// save copies the entry into the local store, the directory is the source of truth.
+// Accounts of single sign-on or local passwords are never taken over.
+func (a *ldapAuthenticator) save(entry *ldap.Entry) (*user.User, error) {
+	c := a.config.LDAP
+	name := entry.GetAttributeValue(c.NameAttr)
+	if user.ValidName(name) == false {
+		return nil, fmt.Errorf("Unsupported user name %s", name)
+	}
+	apply := func(u *user.User) error {
+		if 0 < len(u.Subject) {
+			return fmt.Errorf("%s is already taken by a single sign-on user", name)
+		} else if 0 < len(u.Password) {
+			// the local account signed up before the directory was configured, someone else may own it.
+			return fmt.Errorf("%s is already taken by a local user", name)
+		}
+		u.Email = entry.GetAttributeValue(c.EmailAttr)
+		u.Groups = entry.GetAttributeValues(c.GroupAttr)
+		u.Roles = nil
+		for _, g := range u.Groups {
+			if r, ok := c.Roles[g]; ok {
+				u.Roles = append(u.Roles, r)
+			}
+		}
+		return nil
+	}
+
+	u, err := a.users.Update(name, apply)
+	if err != user.UserNotFound {
+		return u, err
+	}
+	u = &user.User{Name: name}
+	apply(u)
+	if err := a.users.Create(u); err == user.UserExists {
+		return nil, fmt.Errorf("%s is already taken by another user", name)
+	} else if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
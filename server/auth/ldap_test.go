@@ -0,0 +1,210 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package auth_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/auth"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// directory is a stand-in of the LDAP server which knows a few entries.
+type directory struct {
+	passwords map[string]string
+	entries   []*ldap.Entry
+	tls       *tls.Config
+	bound     []string
+	filters   []string
+}
+
+func (d *directory) StartTLS(config *tls.Config) error {
+	d.tls = config
+	return nil
+}
+
+func (d *directory) Bind(username, password string) error {
+	if p, ok := d.passwords[username]; ok == false || p != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, fmt.Errorf("invalid credentials"))
+	}
+	d.bound = append(d.bound, username)
+	return nil
+}
+
+func (d *directory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.filters = append(d.filters, req.Filter)
+	res := &ldap.SearchResult{}
+	for _, e := range d.entries {
+		if req.Filter == fmt.Sprintf("(uid=%s)", e.GetAttributeValue("uid")) && strings.HasSuffix(e.DN, req.BaseDN) {
+			res.Entries = append(res.Entries, e)
+		}
+	}
+	return res, nil
+}
+
+func (d *directory) Close() error {
+	return nil
+}
+
+var _ = Describe("LDAP", func() {
+	var (
+		c    config.Config
+		d    *directory
+		a    Authenticator
+		root string
+	)
+	BeforeEach(func() {
+		c = config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "auth")
+		Expect(err).To(BeNil())
+		root = p
+		c.Users = p
+		c.LDAP.URL = "ldap://ldap.example.com:389"
+		c.LDAP.StartTLS = true
+		c.LDAP.BindDN = "cn=gotive,dc=example,dc=com"
+		c.LDAP.BindPassword = "service"
+		c.LDAP.BaseDN = "ou=people,dc=example,dc=com"
+		c.LDAP.Roles = map[string]string{"cn=admins,ou=groups,dc=example,dc=com": "admin"}
+
+		d = &directory{
+			passwords: map[string]string{
+				"cn=gotive,dc=example,dc=com":         "service",
+				"uid=way,ou=people,dc=example,dc=com": "secret",
+			},
+			entries: []*ldap.Entry{
+				ldap.NewEntry("uid=way,ou=people,dc=example,dc=com", map[string][]string{
+					"uid":      {"way"},
+					"mail":     {"way@example.com"},
+					"memberOf": {"cn=admins,ou=groups,dc=example,dc=com", "cn=dev,ou=groups,dc=example,dc=com"},
+				}),
+			},
+		}
+		a = NewLDAP(c, func(config.Config) (LDAPConn, error) { return d, nil })
+	})
+	AfterEach(func() {
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	It("bind as the user found by the filter", func() {
+		u, err := a.Authenticate("way", "secret")
+		Expect(err).To(BeNil())
+		Expect(u.Name).To(Equal("way"))
+		Expect(u.Email).To(Equal("way@example.com"))
+		Expect(u.Groups).To(HaveLen(2))
+		Expect(u.Roles).To(Equal([]string{"admin"}))
+		Expect(u.HasRole("admin")).To(BeTrue())
+		Expect(u.Password).To(BeEmpty())
+
+		Expect(d.tls.ServerName).To(Equal("ldap.example.com"))
+		Expect(d.bound).To(Equal([]string{"cn=gotive,dc=example,dc=com", "uid=way,ou=people,dc=example,dc=com"}))
+
+		found, err := user.New(c).Find("way")
+		Expect(err).To(BeNil())
+		Expect(found.Roles).To(Equal([]string{"admin"}))
+	})
+
+	It("verify the server by the CA file", func() {
+		c.LDAP.InsecureSkipVerify = true
+		c.LDAP.CAFile = filepath.Join(root, "ca.pem")
+		Expect(ioutil.WriteFile(c.LDAP.CAFile, []byte("no certificates"), 0644)).To(BeNil())
+		_, err := a.Authenticate("way", "secret")
+		Expect(err).NotTo(BeNil())
+		Expect(err).NotTo(Equal(user.FailToAuthenticate))
+		Expect(d.tls).To(BeNil())
+
+		c.LDAP.CAFile = ""
+		_, err = a.Authenticate("way", "secret")
+		Expect(err).To(BeNil())
+		Expect(d.tls.InsecureSkipVerify).To(BeTrue())
+		Expect(d.tls.RootCAs).To(BeNil())
+	})
+
+	It("reject wrong password", func() {
+		_, err := a.Authenticate("way", "wrong")
+		Expect(err).To(Equal(user.FailToAuthenticate))
+	})
+
+	It("reject empty password", func() {
+		d.passwords["uid=way,ou=people,dc=example,dc=com"] = ""
+		_, err := a.Authenticate("way", "")
+		Expect(err).To(Equal(user.FailToAuthenticate))
+	})
+
+	It("reject unknown user", func() {
+		_, err := a.Authenticate("nobody", "secret")
+		Expect(err).To(Equal(user.FailToAuthenticate))
+	})
+
+	It("escape the name in the filter", func() {
+		_, err := a.Authenticate("*)(uid=*", "secret")
+		Expect(err).To(Equal(user.FailToAuthenticate))
+		Expect(d.filters).To(Equal([]string{`(uid=\2a\29\28uid=\2a)`}))
+	})
+
+	It("never take over a single sign-on user", func() {
+		Expect(user.New(c).Save(&user.User{Name: "way", Subject: "https://idp.example.com#1"})).To(BeNil())
+		_, err := a.Authenticate("way", "secret")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("never take over a local user with password", func() {
+		local := &user.User{Name: "way", Email: "local@example.com"}
+		Expect(local.SetPassword("password")).To(BeNil())
+		Expect(user.New(c).Save(local)).To(BeNil())
+		_, err := a.Authenticate("way", "secret")
+		Expect(err).NotTo(BeNil())
+
+		found, err := user.New(c).Find("way")
+		Expect(err).To(BeNil())
+		Expect(found.Email).To(Equal("local@example.com"))
+		Expect(found.Roles).To(BeEmpty())
+		Expect(found.MatchPassword("password")).To(BeTrue())
+	})
+
+	It("update the directory user at every login", func() {
+		_, err := a.Authenticate("way", "secret")
+		Expect(err).To(BeNil())
+		d.entries[0] = ldap.NewEntry("uid=way,ou=people,dc=example,dc=com", map[string][]string{
+			"uid":  {"way"},
+			"mail": {"new@example.com"},
+		})
+		u, err := a.Authenticate("way", "secret")
+		Expect(err).To(BeNil())
+		Expect(u.Email).To(Equal("new@example.com"))
+		Expect(u.Roles).To(BeEmpty())
+	})
+
+	It("use local users without directory", func() {
+		c.LDAP.URL = ""
+		Expect(External(c)).To(BeFalse())
+		u := &user.User{Name: "local"}
+		Expect(u.SetPassword("password")).To(BeNil())
+		Expect(user.New(c).Save(u)).To(BeNil())
+
+		found, err := New(c).Authenticate("local", "password")
+		Expect(err).To(BeNil())
+		Expect(found.Name).To(Equal("local"))
+	})
+})
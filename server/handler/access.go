@@ -0,0 +1,106 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+)
+
+// reader returns the user whose access counts for reading, a token without gist:read reads as anonymous.
+func reader(v *Visitor) *user.User {
+	if v.Can(token.Read) {
+		return v.User
+	}
+	return nil
+}
+
+// writer returns the user whose access counts for writing.
+func writer(v *Visitor) *user.User {
+	if v.Can(token.Write) {
+		return scoped(v)
+	}
+	return nil
+}
+
+// scoped returns the user of the visitor, whose admin role counts only with the admin scope,
+// so that a leaked gist:write token can not manage gists of others.
+func scoped(v *Visitor) *user.User {
+	if v.User == nil || v.User.HasRole(user.AdminRole) == false || v.Can(token.Admin) {
+		return v.User
+	}
+	u := *v.User
+	u.Roles = nil
+	for _, r := range v.User.Roles {
+		if r != user.AdminRole {
+			u.Roles = append(u.Roles, r)
+		}
+	}
+	return &u
+}
+
+// loadReadable loads the gist of the request for pages, gists hidden from the visitor are not found.
+func loadReadable(res render.Render, p martini.Params, v *Visitor, c config.Config) (repo.Repo, bool) {
+	r, err := acl.New(c).Load(reader(v), p["id"])
+	if err == acl.NotFound {
+		handleNotFound(res, err)
+		return nil, false
+	} else if err != nil {
+		handleError(res, err)
+		return nil, false
+	}
+	return r, true
+}
+
+// loadWritable loads the gist of the request, only if the visitor may change it.
+func loadWritable(res render.Render, p martini.Params, v *Visitor, c config.Config) (repo.Repo, bool) {
+	r, ok := loadReadable(res, p, v, c)
+	if ok == false {
+		return nil, false
+	}
+	if ok, err := acl.New(c).Writable(writer(v), r); err != nil {
+		handleError(res, err)
+		return nil, false
+	} else if ok == false {
+		res.Error(403)
+		return nil, false
+	}
+	return r, true
+}
+
+// cacheControl lets shared caches keep immutable responses of gists which everyone may read.
+func cacheControl(h http.Header, r repo.Repo, immutable bool) error {
+	if immutable == false {
+		h.Set("Cache-Control", "no-cache")
+		return nil
+	}
+	v, err := r.Visibility()
+	if err != nil {
+		return err
+	}
+	if v == repo.Private {
+		h.Set("Cache-Control", "private, max-age=31536000")
+	} else {
+		h.Set("Cache-Control", "public, max-age=31536000")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+)
+
+var _ = Describe("access", func() {
+	admin := &user.User{Name: "admin", Roles: []string{"dev", user.AdminRole}}
+
+	It("count the admin role only with the admin scope", func() {
+		u := writer(&Visitor{User: admin, Token: &token.Token{Scopes: []string{token.Write}}})
+		Expect(u.Name).To(Equal("admin"))
+		Expect(u.HasRole(user.AdminRole)).To(BeFalse())
+		Expect(u.HasRole("dev")).To(BeTrue())
+		Expect(admin.HasRole(user.AdminRole)).To(BeTrue())
+
+		u = writer(&Visitor{User: admin, Token: &token.Token{Scopes: []string{token.Admin}}})
+		Expect(u.HasRole(user.AdminRole)).To(BeTrue())
+		u = writer(&Visitor{User: admin, Cookie: true})
+		Expect(u.HasRole(user.AdminRole)).To(BeTrue())
+
+		u, err := apiUser(&Visitor{User: admin, Token: &token.Token{Scopes: []string{token.Write}}}, token.Write)
+		Expect(err).To(BeNil())
+		Expect(u.HasRole(user.AdminRole)).To(BeFalse())
+		u, err = apiUser(&Visitor{User: admin, Token: &token.Token{Scopes: []string{token.Admin}}}, token.Write)
+		Expect(err).To(BeNil())
+		Expect(u.HasRole(user.AdminRole)).To(BeTrue())
+	})
+
+	It("read and write with the scopes of tokens", func() {
+		readOnly := &Visitor{User: admin, Token: &token.Token{Scopes: []string{token.Read}}}
+		Expect(reader(readOnly)).To(Equal(admin))
+		Expect(writer(readOnly)).To(BeNil())
+		Expect(writer(&Visitor{})).To(BeNil())
+	})
+})
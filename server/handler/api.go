@@ -0,0 +1,557 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type apiFile struct {
+	Filename string `json:"filename"`
+	Size     int    `json:"size"`
+	RawURL   string `json:"raw_url,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+type apiGist struct {
+	Id          string             `json:"id"`
+	URL         string             `json:"url"`
+	Description string             `json:"description"`
+	Owner       string             `json:"owner,omitempty"`
+	Org         string             `json:"org,omitempty"`
+	Public      bool               `json:"public"`
+	Visibility  string             `json:"visibility"`
+	Revision    string             `json:"revision,omitempty"`
+	Files       map[string]apiFile `json:"files"`
+	CreatedAt   *time.Time         `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time         `json:"updated_at,omitempty"`
+}
+
+type apiFileChange struct {
+	Filename *string `json:"filename"`
+	Content  *string `json:"content"`
+}
+
+// apiGistChange is the body to create or edit a gist, Public, Visibility and Org are read only at the creation.
+// Visibility takes precedence over Public, gists are secret by default. Org makes the gist owned by the organization.
+type apiGistChange struct {
+	Description *string                   `json:"description"`
+	Public      *bool                     `json:"public"`
+	Visibility  *string                   `json:"visibility"`
+	Org         *string                   `json:"org"`
+	Files       map[string]*apiFileChange `json:"files"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+}
+
+// apiFailure is an error which knows the status code to answer.
+type apiFailure struct {
+	status int
+	err    error
+}
+
+func (f *apiFailure) Error() string { return f.err.Error() }
+
+func failure(status int, format string, args ...interface{}) error {
+	return &apiFailure{status: status, err: fmt.Errorf(format, args...)}
+}
+
+func handleAPIError(res render.Render, err error) {
+	if f, ok := err.(*apiFailure); ok {
+		log.Debug(f.err)
+		res.JSON(f.status, apiError{Message: f.err.Error()})
+		return
+	}
+	log.Error(err)
+	res.JSON(500, apiError{Message: "Internal Server Error"})
+}
+
+// ListGists lists public gists, secret ones are never listed.
+func ListGists(req *http.Request, res render.Render, c config.Config, idx *index.Index) {
+	listing, err := idx.List(listed)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	page, err := paginate(req, len(listing))
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+
+	gists := []apiGist{}
+	for _, g := range current(c, nil, listing[page.from:page.to]) {
+		gists = append(gists, indexedAPIGist(req, g))
+	}
+	page.header(res.Header())
+	res.JSON(200, gists)
+}
+
+func GetGist(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	r, err := loadAPIRepo(v, c, p["id"])
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	g, err := toAPIGist(req, r, true)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.JSON(200, g)
+}
+
+func CreateGist(req *http.Request, res render.Render, v *Visitor, c config.Config, idx *index.Index) {
+	u, err := requireUser(v, token.Write)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	change, err := decodeChange(req)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if len(change.Files) < 1 {
+		handleAPIError(res, failure(422, "files are required"))
+		return
+	}
+
+	maker := repo.New(c)
+	r, err := maker.MakeRepo()
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := idx.Mark(r.Id()); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := createGist(r, u, change, c); err != nil {
+		maker.RemoveRepo(r.Id())
+		handleAPIError(res, err)
+		return
+	}
+	syncIndex(idx, r)
+
+	g, err := toAPIGist(req, r, true)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.Header().Set("Location", g.URL)
+	res.JSON(201, g)
+}
+
+func createGist(r repo.Repo, u *user.User, change *apiGistChange, c config.Config) error {
+	owner := u.Name
+	if change.Org != nil {
+		o, err := gistOwner(u, *change.Org, c)
+		if err != nil {
+			return failure(422, "%v", err)
+		}
+		owner = o
+	}
+	desc := ""
+	if change.Description != nil {
+		desc = *change.Description
+	}
+	if err := r.ApplyDesc(desc); err != nil {
+		return err
+	}
+	visibility := repo.Secret
+	if change.Public != nil && *change.Public {
+		visibility = repo.Public
+	}
+	if change.Visibility != nil {
+		v, err := repo.ParseVisibility(*change.Visibility)
+		if err != nil {
+			return failure(422, "%v", err)
+		}
+		visibility = v
+	}
+	if err := r.ApplyVisibility(visibility); err != nil {
+		return err
+	}
+	for name, f := range change.Files {
+		if f == nil || f.Content == nil || len(*f.Content) < 1 {
+			return failure(422, "content of %s is required", name)
+		}
+		if err := r.Add(name, *f.Content); err != nil {
+			return failure(422, "%v", err)
+		}
+	}
+	if err := r.ApplyOwner(owner); err != nil {
+		return err
+	}
+	return r.Commit(u.Name, u.Email)
+}
+
+func EditGist(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	r, u, err := loadWritableRepo(v, c, p["id"])
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	change, err := decodeChange(req)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := idx.Mark(r.Id()); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := r.Change(func() error { return editGist(r, u, change) }); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	syncIndex(idx, r)
+	g, err := toAPIGist(req, r, true)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.JSON(200, g)
+}
+
+// editGist applies change to r, a nil file removes it and a filename renames it.
+// The whole change is checked first, files are changed in the order of their names,
+// and the description is applied only after the files are committed.
+func editGist(r repo.Repo, u *user.User, change *apiGistChange) error {
+	files, err := r.Files(repo.Head)
+	if err != nil {
+		return err
+	}
+	exists := map[string]bool{}
+	for _, f := range files {
+		exists[f] = true
+	}
+
+	names := []string{}
+	for name, f := range change.Files {
+		switch {
+		case f == nil && exists[name] == false:
+			return failure(422, "%s does not exist", name)
+		case f != nil && exists[name] == false && f.Content == nil:
+			return failure(422, "content of %s is required", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := editFiles(r, u, change, names, exists); err != nil {
+		discard(r)
+		return err
+	}
+	if change.Description != nil {
+		return r.ApplyDesc(*change.Description)
+	}
+	return nil
+}
+
+// editFiles changes the files of names and commits them when anything is changed.
+func editFiles(r repo.Repo, u *user.User, change *apiGistChange, names []string, exists map[string]bool) error {
+	for _, name := range names {
+		f := change.Files[name]
+		switch {
+		case f == nil:
+			if err := r.Remove(name); err != nil {
+				return err
+			}
+		case exists[name] == false:
+			if err := r.Add(name, *f.Content); err != nil {
+				return failure(422, "%v", err)
+			}
+		default:
+			if f.Filename != nil && *f.Filename != name {
+				if err := r.Rename(name, *f.Filename); err != nil {
+					return failure(422, "%v", err)
+				}
+				name = *f.Filename
+			}
+			if f.Content != nil {
+				if err := r.Update(name, *f.Content); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if staged, err := r.Staged(); err != nil || staged == false {
+		return err
+	}
+	name, email := "", ""
+	if u != nil {
+		name, email = u.Name, u.Email
+	}
+	return r.Commit(name, email)
+}
+
+func DeleteGist(res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	r, u, err := loadWritableRepo(v, c, p["id"])
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	// collaborators change the gist, but only the owner removes it
+	if ok, err := acl.New(c).Manageable(u, r); err != nil {
+		handleAPIError(res, err)
+		return
+	} else if ok == false {
+		handleAPIError(res, failure(403, "Forbidden"))
+		return
+	}
+	if err := idx.Mark(r.Id()); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := repo.New(c).RemoveRepo(r.Id()); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := idx.Remove(r.Id()); err != nil {
+		log.Errorf("fail to unindex %s: %v", r.Id(), err)
+	}
+	res.Status(204)
+}
+
+// apiUser returns the user authenticated by the request headers, cookies are ignored against CSRF.
+// A token without scope is rejected rather than treated as anonymous.
+func apiUser(v *Visitor, scope string) (*user.User, error) {
+	if v.Err != nil {
+		return nil, failure(401, "Bad credentials")
+	}
+	if v.Cookie {
+		return nil, nil
+	}
+	if v.User != nil && v.Can(scope) == false {
+		return nil, failure(403, fmt.Sprintf("Token requires the %s scope", scope))
+	}
+	return scoped(v), nil
+}
+
+func requireUser(v *Visitor, scope string) (*user.User, error) {
+	u, err := apiUser(v, scope)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, failure(401, "Requires authentication")
+	}
+	return u, nil
+}
+
+// loadAPIRepo loads the gist which the visitor may read, hidden gists are not found.
+func loadAPIRepo(v *Visitor, c config.Config, id string) (repo.Repo, error) {
+	u, err := apiUser(v, token.Read)
+	if err != nil {
+		return nil, err
+	}
+	return loadRepoFor(u, c, id)
+}
+
+func loadRepoFor(u *user.User, c config.Config, id string) (repo.Repo, error) {
+	r, err := acl.New(c).Load(u, id)
+	if err == acl.NotFound {
+		return nil, failure(404, "Not Found")
+	}
+	return r, err
+}
+
+func loadWritableRepo(v *Visitor, c config.Config, id string) (repo.Repo, *user.User, error) {
+	u, err := apiUser(v, token.Write)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := loadRepoFor(u, c, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok, err := acl.New(c).Writable(u, r); err != nil {
+		return nil, nil, err
+	} else if ok == false {
+		if u == nil {
+			return nil, nil, failure(401, "Requires authentication")
+		}
+		return nil, nil, failure(403, "Forbidden")
+	}
+	return r, u, nil
+}
+
+func decodeChange(req *http.Request) (*apiGistChange, error) {
+	change := &apiGistChange{}
+	if err := json.NewDecoder(req.Body).Decode(change); err != nil {
+		return nil, failure(400, "Problems parsing JSON")
+	}
+	return change, nil
+}
+
+func toAPIGist(req *http.Request, r repo.Repo, withContent bool) (apiGist, error) {
+	g := apiGist{Id: r.Id(), URL: absURL(req, "/api/v1/gists/%s", r.Id()), Files: map[string]apiFile{}}
+	var err error
+	if g.Description, err = r.Desc(); err != nil {
+		return g, err
+	}
+	if g.Owner, err = r.Owner(); err != nil {
+		return g, err
+	}
+	if name, ok := org.ParseOwner(g.Owner); ok {
+		g.Owner, g.Org = "", name
+	}
+	visibility, err := r.Visibility()
+	if err != nil {
+		return g, err
+	}
+	g.Visibility, g.Public = string(visibility), visibility == repo.Public
+
+	revs, err := r.Log()
+	if err != nil {
+		return g, err
+	}
+	if len(revs) < 1 {
+		return g, nil
+	}
+	g.Revision = revs[0].Id
+	g.UpdatedAt, g.CreatedAt = &revs[0].Date, &revs[len(revs)-1].Date
+
+	files, err := r.Files(g.Revision)
+	if err != nil {
+		return g, err
+	}
+	for _, name := range files {
+		b, err := r.Show(g.Revision, name)
+		if err != nil {
+			return g, err
+		}
+		f := apiFile{Filename: name, Size: len(b), RawURL: absURL(req, "/%s/%s/raw/%s", r.Id(), g.Revision, name)}
+		if withContent {
+			f.Content = string(b)
+		}
+		g.Files[name] = f
+	}
+	return g, nil
+}
+
+// indexedAPIGist describes g as the index knows it, so listings never read repositories.
+func indexedAPIGist(req *http.Request, g *index.Gist) apiGist {
+	a := apiGist{
+		Id:          g.Id,
+		URL:         absURL(req, "/api/v1/gists/%s", g.Id),
+		Description: g.Description,
+		Owner:       g.Owner,
+		Public:      g.Visibility == repo.Public,
+		Visibility:  string(g.Visibility),
+		Files:       map[string]apiFile{},
+	}
+	if name, ok := org.ParseOwner(g.Owner); ok {
+		a.Owner, a.Org = "", name
+	}
+	if len(g.Revision) < 1 {
+		return a
+	}
+	a.Revision = g.Revision
+	a.CreatedAt, a.UpdatedAt = &g.Created, &g.Updated
+	for _, f := range g.Files {
+		a.Files[f.Name] = apiFile{Filename: f.Name, Size: f.Size, RawURL: absURL(req, "/%s/%s/raw/%s", g.Id, g.Revision, f.Name)}
+	}
+	return a
+}
+
+func absURL(req *http.Request, format string, args ...interface{}) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, req.Host) + fmt.Sprintf(format, args...)
+}
+
+type page struct {
+	number, size    int
+	total, from, to int
+}
+
+// paginate reads page and per_page from the query, page starts from 1.
+func paginate(req *http.Request, total int) (page, error) {
+	number, size := 1, 30
+	q := req.URL.Query()
+	if v := q.Get("page"); 0 < len(v) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return page{}, failure(400, "Invalid page %s", v)
+		}
+		number = n
+	}
+	if v := q.Get("per_page"); 0 < len(v) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || 100 < n {
+			return page{}, failure(400, "Invalid per_page %s", v)
+		}
+		size = n
+	}
+	// pages past the last one are empty, number is compared before it is multiplied so that it never overflows.
+	p := page{number: number, size: size, total: total, from: total, to: total}
+	if number <= (total+size-1)/size {
+		p.from = (number - 1) * size
+		if number*size < total {
+			p.to = number * size
+		}
+	}
+	return p, nil
+}
+
+func (p page) header(h http.Header) {
+	h.Set("X-Total-Count", strconv.Itoa(p.total))
+}
+
+// links writes the Link header in the same manner as GitHub.
+func (p page) links(req *http.Request, h http.Header) {
+	last := (p.total + p.size - 1) / p.size
+	link := func(number int, rel string) string {
+		q := req.URL.Query()
+		q.Set("page", strconv.Itoa(number))
+		q.Set("per_page", strconv.Itoa(p.size))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, absURL(req, "%s", req.URL.Path), q.Encode(), rel)
+	}
+	links := []string{}
+	if p.number < last {
+		links = append(links, link(p.number+1, "next"), link(last, "last"))
+	}
+	if 1 < p.number {
+		links = append(links, link(1, "first"), link(p.number-1, "prev"))
+	}
+	if 0 < len(links) {
+		h.Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,180 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/token"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("REST API", func() {
+	var s *site
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("way")
+		s.makeUser("other")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	gist := map[string]interface{}{
+		"description": "hello",
+		"public":      true,
+		"files":       map[string]interface{}{"hello.go": map[string]string{"content": "package main"}},
+	}
+	mint := func(name string, scopes ...string) string {
+		u := s.makeUser(name)
+		secret, _, err := token.New(s.c).Mint(u, "spec", scopes, time.Time{})
+		Expect(err).To(BeNil())
+		return secret
+	}
+	message := func(res *http.Response) string {
+		body := map[string]string{}
+		decode(res, &body)
+		return body["message"]
+	}
+
+	It("create gists and read them back", func() {
+		res := s.send("POST", "/api/v1/gists", gist, basic("way"))
+		Expect(res.StatusCode).To(Equal(201))
+		Expect(res.Header.Get("Content-Type")).To(HavePrefix("application/json"))
+		created := map[string]interface{}{}
+		decode(res, &created)
+		id := created["id"].(string)
+		Expect(res.Header.Get("Location")).To(Equal(s.server.URL + "/api/v1/gists/" + id))
+		Expect(created["owner"]).To(Equal("way"))
+		Expect(created["visibility"]).To(Equal("public"))
+
+		res = s.get("/api/v1/gists/" + id)
+		Expect(res.StatusCode).To(Equal(200))
+		found := struct {
+			Description string
+			Files       map[string]struct{ Content string }
+		}{}
+		decode(res, &found)
+		Expect(found.Description).To(Equal("hello"))
+		Expect(found.Files["hello.go"].Content).To(Equal("package main"))
+	})
+
+	It("answer errors with status codes and JSON messages", func() {
+		res := s.send("POST", "/api/v1/gists", gist, nil)
+		Expect(res.StatusCode).To(Equal(401))
+		Expect(message(res)).To(Equal("Requires authentication"))
+
+		header := basic("way")
+		header.Set("Authorization", strings.Replace(header.Get("Authorization"), "Basic ", "Basic x", 1))
+		Expect(s.send("POST", "/api/v1/gists", gist, header).StatusCode).To(Equal(401))
+
+		Expect(s.do("POST", "/api/v1/gists", strings.NewReader("{"), basic("way")).StatusCode).To(Equal(400))
+		res = s.send("POST", "/api/v1/gists", map[string]interface{}{"files": map[string]interface{}{}}, basic("way"))
+		Expect(res.StatusCode).To(Equal(422))
+		Expect(message(res)).To(Equal("files are required"))
+		res = s.send("POST", "/api/v1/gists", map[string]interface{}{"visibility": "hidden", "files": gist["files"]}, basic("way"))
+		Expect(res.StatusCode).To(Equal(422))
+
+		res = s.get("/api/v1/gists/missing")
+		Expect(res.StatusCode).To(Equal(404))
+		Expect(message(res)).To(Equal("Not Found"))
+		Expect(s.get("/api/v1/gists?page=0").StatusCode).To(Equal(400))
+		Expect(s.get("/api/v1/gists?per_page=101").StatusCode).To(Equal(400))
+	})
+
+	It("ignore the login session against CSRF", func() {
+		s.signIn("way")
+		Expect(s.send("POST", "/api/v1/gists", gist, nil).StatusCode).To(Equal(401))
+	})
+
+	It("limit tokens to their scopes", func() {
+		Expect(s.send("POST", "/api/v1/gists", gist, bearer(mint("way", token.Read))).StatusCode).To(Equal(403))
+		Expect(s.send("POST", "/api/v1/gists", gist, bearer(mint("way", token.Write))).StatusCode).To(Equal(201))
+		Expect(s.send("POST", "/api/v1/gists", gist, bearer("gotive_unknown")).StatusCode).To(Equal(401))
+	})
+
+	It("let only writers edit gists", func() {
+		r := s.makeGist("way", repo.Secret, "a.txt")
+		change := map[string]interface{}{"description": "changed"}
+		Expect(s.send("PATCH", "/api/v1/gists/"+r.Id(), change, nil).StatusCode).To(Equal(401))
+		Expect(s.send("PATCH", "/api/v1/gists/"+r.Id(), change, basic("other")).StatusCode).To(Equal(403))
+		Expect(s.send("PATCH", "/api/v1/gists/missing", change, basic("way")).StatusCode).To(Equal(404))
+
+		for _, files := range []map[string]interface{}{
+			{"a.txt": map[string]string{"content": "a"}, "missing.txt": nil},
+			{"a.txt": map[string]string{"filename": ".git/config"}},
+		} {
+			res := s.send("PATCH", "/api/v1/gists/"+r.Id(), map[string]interface{}{
+				"description": "failed",
+				"files":       files,
+			}, basic("way"))
+			Expect(res.StatusCode).To(Equal(422))
+			desc, err := r.Desc()
+			Expect(err).To(BeNil())
+			Expect(desc).NotTo(Equal("failed"))
+			b, err := r.Show(repo.Head, "a.txt")
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal("content of a.txt"))
+		}
+
+		res := s.send("PATCH", "/api/v1/gists/"+r.Id(), map[string]interface{}{
+			"description": "changed",
+			"files":       map[string]interface{}{"a.txt": map[string]string{"filename": "b.txt", "content": "b"}},
+		}, basic("way"))
+		Expect(res.StatusCode).To(Equal(200))
+		edited := struct {
+			Description string
+			Files       map[string]struct{ Content string }
+		}{}
+		decode(res, &edited)
+		Expect(edited.Description).To(Equal("changed"))
+		Expect(edited.Files).To(HaveLen(1))
+		Expect(edited.Files["b.txt"].Content).To(Equal("b"))
+	})
+
+	It("let only the owner delete gists", func() {
+		r := s.makeGist("way", repo.Public, "a.txt")
+		Expect(r.ApplyWriters([]string{"user:other"})).To(BeNil())
+		Expect(s.do("DELETE", "/api/v1/gists/"+r.Id(), nil, nil).StatusCode).To(Equal(401))
+		Expect(s.do("DELETE", "/api/v1/gists/"+r.Id(), nil, basic("other")).StatusCode).To(Equal(403))
+
+		Expect(s.do("DELETE", "/api/v1/gists/"+r.Id(), nil, basic("way")).StatusCode).To(Equal(204))
+		Expect(s.get("/api/v1/gists/" + r.Id()).StatusCode).To(Equal(404))
+		_, err := s.idx.Get(r.Id())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("list public gists with pages", func() {
+		s.makeGist("way", repo.Secret, "secret.txt")
+		for i := 0; i < 3; i++ {
+			s.makeGist("way", repo.Public, "public.txt")
+		}
+		res := s.get("/api/v1/gists?per_page=2&page=2")
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("X-Total-Count")).To(Equal("3"))
+		listing := []map[string]interface{}{}
+		decode(res, &listing)
+		Expect(listing).To(HaveLen(1))
+		Expect(listing[0]["visibility"]).To(Equal("public"))
+
+		listing = []map[string]interface{}{}
+		decode(s.get("/api/v1/gists?page=9223372036854775807"), &listing)
+		Expect(listing).To(BeEmpty())
+	})
+})
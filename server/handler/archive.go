@@ -0,0 +1,70 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"net/http"
+)
+
+// Archive streams the tree of the revision as zip or tar.gz.
+func Archive(w http.ResponseWriter, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	r, ok := loadReadable(res, p, v, c)
+	if ok == false {
+		return
+	}
+	sha, err := r.Resolve(p["rev"])
+	if err != nil {
+		handleNotFound(res, err)
+		return
+	}
+
+	name := fmt.Sprintf("%s-%s", r.Id(), p["rev"])
+	filename := name + "." + p["format"]
+	h := w.Header()
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	h.Set("X-Content-Type-Options", "nosniff")
+	if err := cacheControl(h, r, p["rev"] == sha); err != nil {
+		handleError(res, err)
+		return
+	}
+
+	switch p["format"] {
+	case "zip":
+		h.Set("Content-Type", "application/zip")
+		w.WriteHeader(200)
+		err = r.Archive(sha, "zip", name+"/", w)
+	case "tar.gz":
+		h.Set("Content-Type", "application/gzip")
+		w.WriteHeader(200)
+		gz := gzip.NewWriter(w)
+		if err = r.Archive(sha, "tar", name+"/", gz); err == nil {
+			err = gz.Close()
+		}
+	default:
+		handleNotFound(res, fmt.Errorf("Unsupported format %s", p["format"]))
+		return
+	}
+	if err != nil {
+		// the status is already sent, so the client only sees a broken archive.
+		log.Error(err)
+	}
+}
@@ -0,0 +1,112 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+var _ = Describe("Archive", func() {
+	var (
+		s *site
+		r repo.Repo
+	)
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("way")
+		s.makeUser("other")
+		r = s.makeGist("way", repo.Public, "a.txt", "dir/b.txt")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	It("zip the tree of the revision", func() {
+		res := s.get("/" + r.Id() + "/archive/HEAD.zip")
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Content-Type")).To(Equal("application/zip"))
+		Expect(res.Header.Get("Content-Disposition")).To(Equal(`attachment; filename="` + r.Id() + `-HEAD.zip"`))
+		Expect(res.Header.Get("Cache-Control")).To(Equal("no-cache"))
+
+		b := []byte(text(res))
+		z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		Expect(err).To(BeNil())
+		names := []string{}
+		for _, f := range z.File {
+			if f.FileInfo().IsDir() == false {
+				names = append(names, f.Name)
+			}
+		}
+		sort.Strings(names)
+		prefix := r.Id() + "-HEAD/"
+		Expect(names).To(Equal([]string{prefix + "a.txt", prefix + "dir/b.txt"}))
+	})
+
+	It("tar the tree of the revision", func() {
+		revs, err := r.Log()
+		Expect(err).To(BeNil())
+		Expect(r.Update("a.txt", "changed")).To(BeNil())
+		Expect(r.Commit("way", "way@example.com")).To(BeNil())
+
+		res := s.get("/" + r.Id() + "/archive/" + revs[0].Id + ".tar.gz")
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Content-Type")).To(Equal("application/gzip"))
+		Expect(res.Header.Get("Cache-Control")).To(Equal("public, max-age=31536000"))
+
+		gz, err := gzip.NewReader(res.Body)
+		Expect(err).To(BeNil())
+		defer res.Body.Close()
+		t := tar.NewReader(gz)
+		contents := map[string]string{}
+		for {
+			h, err := t.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).To(BeNil())
+			b, err := ioutil.ReadAll(t)
+			Expect(err).To(BeNil())
+			contents[h.Name] = string(b)
+		}
+		Expect(contents[r.Id()+"-"+revs[0].Id+"/a.txt"]).To(Equal("content of a.txt"))
+	})
+
+	It("answer missing revisions and formats as not found", func() {
+		Expect(s.get("/" + r.Id() + "/archive/0000000.zip").StatusCode).To(Equal(404))
+		Expect(s.get("/" + r.Id() + "/archive/HEAD.rar").StatusCode).To(Equal(404))
+		Expect(s.get("/missing/archive/HEAD.zip").StatusCode).To(Equal(404))
+	})
+
+	It("hide private gists from others", func() {
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		path := "/" + r.Id() + "/archive/HEAD.zip"
+		Expect(s.get(path).StatusCode).To(Equal(404))
+		Expect(s.do("GET", path, nil, basic("other")).StatusCode).To(Equal(404))
+		Expect(s.do("GET", path, nil, basic("way")).StatusCode).To(Equal(200))
+
+		Expect(r.ApplyReaders([]string{"user:other"})).To(BeNil())
+		Expect(s.do("GET", path, nil, basic("other")).StatusCode).To(Equal(200))
+	})
+})
@@ -0,0 +1,132 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/auth"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Visitor is the user who sent the request, a nil User means anonymous.
+type Visitor struct {
+	User *user.User
+	// Err is set when credentials were given but they were wrong.
+	Err error
+	// Cookie is set when the user comes from the login session, which the API must not trust.
+	Cookie bool
+	// Token is set when the user comes with a personal access token, which limits the scopes.
+	Token *token.Token
+}
+
+func (v *Visitor) Anonymous() bool {
+	return v.User == nil
+}
+
+// Can reports whether the credentials of the visitor grant scope, passwords and sessions grant all.
+func (v *Visitor) Can(scope string) bool {
+	return v.Token == nil || v.Token.Allows(scope)
+}
+
+// Authenticate resolves the visitor from a token, basic auth or the login session, and maps it for handlers.
+// Tokens are accepted as bearer credentials or as the password of basic auth for git clients.
+func Authenticate(req *http.Request, s sessions.Session, c config.Config, ctx martini.Context) {
+	v := &Visitor{}
+	if secret, ok := bearer(req); ok {
+		v.User, v.Token, v.Err = token.New(c).Authenticate(secret)
+	} else if name, password, ok := req.BasicAuth(); ok {
+		if token.IsToken(password) {
+			v.User, v.Token, v.Err = token.New(c).Authenticate(password)
+		} else {
+			v.User, v.Err = auth.New(c).Authenticate(name, password)
+		}
+	} else if name, ok := s.Get("user").(string); ok {
+		if u, err := user.New(c).Find(name); err == nil {
+			v.User, v.Cookie = u, true
+		} else {
+			s.Delete("user")
+		}
+	}
+	if v.Err != nil {
+		log.Debug(v.Err)
+	}
+	ctx.Map(v)
+}
+
+// bearer returns the token of the "Bearer" or the "token" authorization scheme.
+func bearer(req *http.Request) (string, bool) {
+	h := req.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "token "} {
+		if len(scheme) < len(h) && strings.EqualFold(h[:len(scheme)], scheme) {
+			return strings.TrimSpace(h[len(scheme):]), true
+		}
+	}
+	return "", false
+}
+
+// newModel makes the model of HTML pages, the layout shows the login state from it.
+func newModel(s sessions.Session, v *Visitor) map[string]interface{} {
+	return map[string]interface{}{
+		"login": v.User,
+		"csrf":  csrfToken(s),
+	}
+}
+
+func csrfToken(s sessions.Session) string {
+	if t, ok := s.Get("csrf").(string); ok {
+		return t
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	t := hex.EncodeToString(b)
+	s.Set("csrf", t)
+	return t
+}
+
+// CheckCSRF rejects form posts which do not carry the token of the session.
+func CheckCSRF(req *http.Request, s sessions.Session, res render.Render) {
+	want, ok := s.Get("csrf").(string)
+	got := req.FormValue("_csrf")
+	if ok == false || subtle.ConstantTimeCompare([]byte(want), []byte(got)) != 1 {
+		res.Error(403)
+	}
+}
+
+// requireLogin sends anonymous visitors to the login page.
+func requireLogin(req *http.Request, res render.Render, v *Visitor) bool {
+	if v.Anonymous() {
+		next := "/"
+		if req.Method == "GET" {
+			next = req.URL.Path
+		}
+		res.Redirect("/login?next=" + url.QueryEscape(next))
+		return false
+	}
+	return true
+}
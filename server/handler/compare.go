@@ -0,0 +1,181 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/highlight"
+	"github.com/taichi/gotive/server/lang"
+	"github.com/taichi/gotive/server/repo"
+	"html/template"
+	"net/http"
+)
+
+// diffLine is a line of a diff with its highlighted html.
+type diffLine struct {
+	repo.DiffLine
+	HTML template.HTML
+}
+
+type diffHunk struct {
+	Header string
+	Lines  []diffLine
+}
+
+// splitRow is a pair of lines shown side by side. A nil side renders as an empty cell.
+type splitRow struct {
+	Old, New *diffLine
+}
+
+type splitHunk struct {
+	Header string
+	Rows   []splitRow
+}
+
+type fileDiff struct {
+	repo.FileDiff
+	// Hunks hides the ones of FileDiff, with highlighted lines.
+	Hunks []diffHunk
+	Split []splitHunk
+}
+
+func Compare(req *http.Request, res render.Render, p martini.Params, s sessions.Session, v *Visitor, c config.Config) {
+	r, ok := loadReadable(res, p, v, c)
+	if ok == false {
+		return
+	}
+
+	from, err := r.Resolve(p["from"])
+	if err != nil {
+		handleNotFound(res, err)
+		return
+	}
+	to, err := r.Resolve(p["to"])
+	if err != nil {
+		handleNotFound(res, err)
+		return
+	}
+
+	diffs, err := r.Diff(from, to)
+	if err != nil {
+		handleError(res, err)
+		return
+	}
+
+	split := req.URL.Query().Get("view") == "split"
+	files := make([]fileDiff, 0, len(diffs))
+	for _, d := range diffs {
+		f := fileDiff{FileDiff: d}
+		if d.Binary == false {
+			f.Hunks = highlightHunks(r, from, to, d)
+		}
+		if split {
+			for _, h := range f.Hunks {
+				f.Split = append(f.Split, splitHunk{Header: h.Header, Rows: pairLines(h)})
+			}
+		}
+		files = append(files, f)
+	}
+
+	model := newModel(s, v)
+	model["id"] = r.Id()
+	model["from"], model["to"] = from, to
+	model["split"] = split
+	model["files"] = files
+	res.HTML(200, "compare", model)
+}
+
+// highlightHunks highlights the old and the new file once each,
+// and takes every line of the hunks by its number in them.
+func highlightHunks(r repo.Repo, from, to string, d repo.FileDiff) []diffHunk {
+	language := lang.Detect(d.Name(), nil)
+	before, after := highlightBlob(r, from, d.OldName, language), highlightBlob(r, to, d.NewName, language)
+	hunks := make([]diffHunk, 0, len(d.Hunks))
+	for _, h := range d.Hunks {
+		lines := make([]diffLine, 0, len(h.Lines))
+		for _, l := range h.Lines {
+			src, no := before, l.Old
+			if l.Kind == repo.Added {
+				src, no = after, l.New
+			}
+			html := template.HTML(template.HTMLEscapeString(l.Text))
+			if 0 < no && no <= len(src) {
+				html = src[no-1]
+			}
+			lines = append(lines, diffLine{l, html})
+		}
+		hunks = append(hunks, diffHunk{h.Header, lines})
+	}
+	return hunks
+}
+
+// highlightBlob renders the lines of the file at rev, nothing when it is missing or fails.
+func highlightBlob(r repo.Repo, rev, name, language string) []template.HTML {
+	if len(name) < 1 {
+		return nil
+	}
+	b, err := r.Show(rev, name)
+	if err != nil {
+		log.Debug(err)
+		return nil
+	}
+	lines, err := highlight.Lines(language, string(b))
+	if err != nil {
+		log.Debug(err)
+		return nil
+	}
+	return lines
+}
+
+// pairLines pairs each run of removed lines with the run of added lines that follows it.
+func pairLines(h diffHunk) []splitRow {
+	rows := []splitRow{}
+	var removed, added []*diffLine
+	flush := func() {
+		for i := 0; i < len(removed) || i < len(added); i++ {
+			row := splitRow{}
+			if i < len(removed) {
+				row.Old = removed[i]
+			}
+			if i < len(added) {
+				row.New = added[i]
+			}
+			rows = append(rows, row)
+		}
+		removed, added = nil, nil
+	}
+	for i := range h.Lines {
+		l := &h.Lines[i]
+		switch l.Kind {
+		case repo.Removed:
+			if 0 < len(added) {
+				flush()
+			}
+			removed = append(removed, l)
+		case repo.Added:
+			added = append(added, l)
+		default:
+			flush()
+			rows = append(rows, splitRow{Old: l, New: l})
+		}
+	}
+	flush()
+	return rows
+}
@@ -0,0 +1,51 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+)
+
+var _ = Describe("Compare", func() {
+	var s *site
+	BeforeEach(func() {
+		s = newSite(nil)
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	It("highlight lines in the context of the whole files", func() {
+		r := s.makeGist("way", repo.Public, "a.py")
+		Expect(r.Update("a.py", "s = \"\"\"\nfirst\n\"\"\"\n")).To(BeNil())
+		Expect(r.Commit("way", "way@example.com")).To(BeNil())
+		from, err := r.Resolve(repo.Head)
+		Expect(err).To(BeNil())
+		Expect(r.Update("a.py", "s = \"\"\"\nsecond\n\"\"\"\n")).To(BeNil())
+		Expect(r.Commit("way", "way@example.com")).To(BeNil())
+		to, err := r.Resolve(repo.Head)
+		Expect(err).To(BeNil())
+
+		for _, view := range []string{"unified", "split"} {
+			body := text(s.get("/" + r.Id() + "/compare/" + from + "..." + to + "?view=" + view))
+			// both lines are inside the string which the lines before open
+			Expect(body).To(ContainSubstring(`<span class="s2">first</span>`), view)
+			Expect(body).To(ContainSubstring(`<span class="s2">second</span>`), view)
+		}
+	})
+})
@@ -0,0 +1,77 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"net/url"
+)
+
+var _ = Describe("CSRF", func() {
+	var (
+		s *site
+		r repo.Repo
+	)
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.signIn("way")
+		r = s.makeGist("way", repo.Public, "a.txt")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	forms := func() map[string]url.Values {
+		return map[string]url.Values{
+			"/new":                 {"n": {"b.txt"}, "c": {"forged"}, "visibility": {"public"}},
+			"/login":               {"name": {"way"}, "password": {"password"}},
+			"/logout":              {},
+			"/signup":              {"name": {"moge"}, "password": {"password"}, "confirm": {"password"}},
+			"/settings/tokens":     {"description": {"forged"}, "scopes": {"gist"}},
+			"/orgs/new":            {"name": {"acme"}},
+			"/" + r.Id() + "/edit": {"o": {"a.txt"}, "n": {"a.txt"}, "c": {"forged"}},
+			"/" + r.Id() + "/fork": {},
+		}
+	}
+
+	It("reject form posts without the token of the session", func() {
+		for path, form := range forms() {
+			Expect(s.post(path, form).StatusCode).To(Equal(403), path)
+			form.Set("_csrf", "0123456789abcdef0123456789abcdef")
+			Expect(s.post(path, form).StatusCode).To(Equal(403), path)
+		}
+		b, err := r.Show(repo.Head, "a.txt")
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("content of a.txt"))
+		// the session survives forged logouts.
+		Expect(text(s.get("/settings/tokens"))).To(ContainSubstring("way"))
+	})
+
+	It("reject tokens of other sessions", func() {
+		token := s.csrf()
+		s.forget()
+		s.signIn("way")
+		form := url.Values{"o": {"a.txt"}, "n": {"a.txt"}, "c": {"forged"}, "_csrf": {token}}
+		Expect(s.post("/"+r.Id()+"/edit", form).StatusCode).To(Equal(403))
+	})
+
+	It("require the token even with credentials", func() {
+		res := s.do("POST", "/new", nil, basic("way"))
+		Expect(res.StatusCode).To(Equal(403))
+	})
+})
@@ -0,0 +1,130 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"time"
+)
+
+type summary struct {
+	Id, Desc, Owner, Org string
+	Languages            []string
+	Updated              time.Time
+}
+
+// Discover lists recent public gists.
+func Discover(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config, idx *index.Index) {
+	gists, err := idx.List(listed)
+	if err != nil {
+		handleError(res, err)
+		return
+	}
+	model := newModel(s, v)
+	if pageModel(req, res, c, nil, model, gists) == false {
+		return
+	}
+	res.HTML(200, "discover", model)
+}
+
+// pageModel puts the summaries of a page of gists into model, for the gists template.
+// The page shows the gists which u may read now, or public ones only for nil.
+func pageModel(req *http.Request, res render.Render, c config.Config, u *user.User, model map[string]interface{}, gists []*index.Gist) bool {
+	page, err := paginate(req, len(gists))
+	if err != nil {
+		res.Error(400)
+		return false
+	}
+	summaries := []summary{}
+	for _, g := range current(c, u, gists[page.from:page.to]) {
+		summaries = append(summaries, summarize(g))
+	}
+	model["gists"] = summaries
+	model["path"] = req.URL.Path
+	if 1 < page.number {
+		model["prev"] = page.number - 1
+	}
+	if page.to < page.total {
+		model["next"] = page.number + 1
+	}
+	return true
+}
+
+func summarize(g *index.Gist) summary {
+	s := summary{Id: g.Id, Desc: g.Description, Owner: g.Owner, Languages: g.Languages(), Updated: g.Updated}
+	if name, ok := org.ParseOwner(g.Owner); ok {
+		s.Owner, s.Org = "", name
+	}
+	return s
+}
+
+// listed reports whether g may appear in listings, secret and private gists never do.
+func listed(g *index.Gist) bool {
+	return g.Visibility == repo.Public
+}
+
+// current keeps the gists which their repositories still show, the index may lag behind
+// a change of visibility or access. Gists are kept when u may read them, or when they are
+// public for nil, so secret gists never appear in public listings.
+func current(c config.Config, u *user.User, gists []*index.Gist) []*index.Gist {
+	a := acl.New(c)
+	maker := repo.New(c)
+	kept := []*index.Gist{}
+	for _, g := range gists {
+		r, err := maker.LoadRepo(g.Id)
+		if err != nil {
+			log.Debug(err)
+			continue
+		}
+		var ok bool
+		if u == nil {
+			var v repo.Visibility
+			v, err = r.Visibility()
+			ok = v == repo.Public
+		} else {
+			ok, err = a.Readable(u, r)
+		}
+		if err != nil {
+			log.Debug(err)
+		} else if ok {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+func ownedBy(name string) func(g *index.Gist) bool {
+	return func(g *index.Gist) bool {
+		return g.Owner == name
+	}
+}
+
+// syncIndex records the change of r in the index. The change is already made,
+// so a failure is only logged, the gist stays marked and is synced again after a later sync.
+func syncIndex(idx *index.Index, r repo.Repo) {
+	if err := idx.Sync(r); err != nil {
+		log.Errorf("fail to index %s: %v", r.Id(), err)
+	}
+}
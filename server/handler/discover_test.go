@@ -0,0 +1,93 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"net/url"
+	"strings"
+)
+
+var _ = Describe("Discover", func() {
+	var s *site
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("way")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	create := func(visibility string) string {
+		form := url.Values{"_csrf": {s.csrf()}, "d": {"desc"}, "n": {"a.txt"}, "c": {"content"}}
+		if 0 < len(visibility) {
+			form.Set("visibility", visibility)
+		}
+		res := s.post("/new", form)
+		Expect(res.StatusCode).To(Equal(302))
+		return strings.TrimPrefix(res.Header.Get("Location"), "/")
+	}
+
+	It("list only public gists", func() {
+		s.signIn("way")
+		public := create("public")
+		secret := create("")
+		private := create("private")
+		v, err := repo.New(s.c).LoadRepo(secret)
+		Expect(err).To(BeNil())
+		Expect(v.Visibility()).To(Equal(repo.Secret))
+
+		s.forget()
+		body := text(s.get("/discover"))
+		Expect(body).To(ContainSubstring(`href="/` + public + `"`))
+		Expect(body).NotTo(ContainSubstring(secret))
+		Expect(body).NotTo(ContainSubstring(private))
+
+		// secret gists are open to everyone who knows the id
+		Expect(s.get("/" + secret).StatusCode).To(Equal(200))
+		Expect(s.get("/" + private).StatusCode).To(Equal(404))
+	})
+
+	It("never list gists which are not public any more, even if the index lags behind", func() {
+		r := s.makeGist("way", repo.Public, "a.txt")
+		Expect(r.ApplyVisibility(repo.Secret)).To(BeNil())
+
+		Expect(text(s.get("/discover"))).NotTo(ContainSubstring(r.Id()))
+		for _, path := range []string{"/api/v1/gists", "/api/v3/gists/public", "/api/v3/users/way/gists"} {
+			Expect(text(s.get(path))).NotTo(ContainSubstring(r.Id()), path)
+		}
+		// the owner still finds it
+		Expect(text(s.do("GET", "/api/v3/gists", nil, basic("way")))).To(ContainSubstring(r.Id()))
+	})
+
+	It("page the listing", func() {
+		for i := 0; i < 31; i++ {
+			s.makeGist("way", repo.Public, "a.txt")
+		}
+		first := text(s.get("/discover"))
+		Expect(strings.Count(first, "<li>")).To(Equal(30))
+		Expect(first).To(ContainSubstring(`href="/discover?page=2"`))
+
+		second := text(s.get("/discover?page=2"))
+		Expect(strings.Count(second, "<li>")).To(Equal(1))
+		Expect(second).To(ContainSubstring(`href="/discover?page=1"`))
+
+		Expect(text(s.get("/discover?page=9223372036854775807"))).To(ContainSubstring("No gists yet."))
+		Expect(s.get("/discover?page=0").StatusCode).To(Equal(400))
+	})
+})
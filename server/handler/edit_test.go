@@ -0,0 +1,107 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"net/url"
+)
+
+var _ = Describe("Edit", func() {
+	var (
+		s *site
+		r repo.Repo
+	)
+	BeforeEach(func() {
+		s = newSite(nil)
+		r = s.makeGist("way", repo.Public, "a.txt")
+		Expect(r.ApplyDesc("desc")).To(BeNil())
+		s.signIn("way")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	edit := func(form url.Values) int {
+		if _, ok := form["visibility"]; ok == false {
+			form.Set("visibility", "public")
+		}
+		form.Set("_csrf", s.csrf())
+		res := s.post("/"+r.Id()+"/edit", form)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	revisions := func() int {
+		revs, err := r.Log()
+		Expect(err).To(BeNil())
+		return len(revs)
+	}
+	show := func(name string) string {
+		b, err := r.Show(repo.Head, name)
+		Expect(err).To(BeNil())
+		return string(b)
+	}
+
+	It("leave the description and the access as they are when the files fail", func() {
+		form := url.Values{"d": {"changed"}, "visibility": {"private"}, "readers": {""}, "writers": {""},
+			"o": {"a.txt"}, "n": {".git/config"}, "c": {"x"}}
+		Expect(edit(form)).NotTo(Equal(302))
+		desc, err := r.Desc()
+		Expect(err).To(BeNil())
+		Expect(desc).To(Equal("desc"))
+		v, err := r.Visibility()
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(repo.Public))
+		Expect(show("a.txt")).To(Equal("content of a.txt"))
+
+		form.Set("visibility", "hidden")
+		form.Set("n", "a.txt")
+		Expect(edit(form)).To(Equal(400))
+		Expect(revisions()).To(Equal(1))
+	})
+
+	It("keep the line endings of files and skip unchanged ones", func() {
+		Expect(r.Add("dos.txt", "one\r\ntwo\r\n")).To(BeNil())
+		Expect(r.Add("unix.txt", "one\ntwo\n")).To(BeNil())
+		Expect(r.Commit("way", "way@example.com")).To(BeNil())
+
+		form := url.Values{"d": {"desc"}, "o": {"dos.txt", "unix.txt"}, "n": {"dos.txt", "unix.txt"},
+			"c": {"one\r\ntwo\r\n", "one\r\ntwo\r\n"}}
+		Expect(edit(form)).To(Equal(302))
+		Expect(revisions()).To(Equal(2))
+
+		form["c"] = []string{"one\r\ntwo\r\nthree\r\n", "one\r\ntwo\r\nthree\r\n"}
+		Expect(edit(form)).To(Equal(302))
+		Expect(revisions()).To(Equal(3))
+		Expect(show("dos.txt")).To(Equal("one\r\ntwo\r\nthree\r\n"))
+		Expect(show("unix.txt")).To(Equal("one\ntwo\nthree\n"))
+	})
+
+	It("leave binary files out of the form", func() {
+		Expect(r.Add("image.bin", "GIF\x00\x01")).To(BeNil())
+		Expect(r.Commit("way", "way@example.com")).To(BeNil())
+
+		body := text(s.get("/" + r.Id() + "/edit"))
+		Expect(body).To(ContainSubstring(`name="o" value="a.txt"`))
+		Expect(body).NotTo(ContainSubstring(`name="o" value="image.bin"`))
+		Expect(body).To(ContainSubstring("<code>image.bin</code>"))
+
+		Expect(edit(url.Values{"d": {"desc"}, "o": {"a.txt"}, "n": {"a.txt"}, "c": {"changed"}})).To(Equal(302))
+		Expect(show("image.bin")).To(Equal("GIF\x00\x01"))
+	})
+})
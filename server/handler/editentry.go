@@ -0,0 +1,249 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"net/http"
+	"strings"
+)
+
+func EditEntry(res render.Render, p martini.Params, s sessions.Session, v *Visitor, c config.Config) {
+	r, ok := loadWritable(res, p, v, c)
+	if ok == false {
+		return
+	}
+
+	model := newModel(s, v)
+	model["id"] = r.Id()
+
+	if desc, err := r.Desc(); err != nil {
+		handleError(res, err)
+		return
+	} else {
+		model["desc"] = desc
+	}
+
+	if contents, err := readContents(r, repo.Head); err != nil {
+		handleError(res, err)
+		return
+	} else {
+		// binary files never survive a textarea, so they are kept as they are
+		texts, binaries := []content{}, []string{}
+		for _, content := range contents {
+			if strings.IndexByte(content.Content, 0) != -1 {
+				binaries = append(binaries, content.Name)
+			} else {
+				texts = append(texts, content)
+			}
+		}
+		model["contents"] = texts
+		model["binaries"] = binaries
+	}
+
+	if ok, err := manageable(r, v, c); err != nil {
+		handleError(res, err)
+		return
+	} else if ok {
+		model["manageable"] = true
+		visibility, err := r.Visibility()
+		if err != nil {
+			handleError(res, err)
+			return
+		}
+		readers, err := r.Readers()
+		if err != nil {
+			handleError(res, err)
+			return
+		}
+		writers, err := r.Writers()
+		if err != nil {
+			handleError(res, err)
+			return
+		}
+		model["visibility"] = string(visibility)
+		model["readers"] = strings.Join(readers, "\n")
+		model["writers"] = strings.Join(writers, "\n")
+	}
+
+	res.HTML(200, "edit", model)
+}
+
+// UpdateEntry applies the posted form to the working tree and records it as a new commit.
+// Every file is posted as a triple of original name (o), name (n) and content (c).
+// An empty original name means a new file, and an original name listed in x means removal.
+// The description and the access are applied only after the files are committed.
+func UpdateEntry(req *http.Request, p martini.Params, v *Visitor, c config.Config, res render.Render, idx *index.Index) {
+	r, ok := loadWritable(res, p, v, c)
+	if ok == false {
+		return
+	}
+
+	desc := req.FormValue("d")
+	var a *access
+	if ok, err := manageable(r, v, c); err != nil {
+		handleError(res, err)
+		return
+	} else if ok {
+		if a, err = parseAccess(req); err != nil {
+			res.Error(400)
+			return
+		}
+	}
+
+	if err := idx.Mark(r.Id()); err != nil {
+		handleError(res, err)
+		return
+	}
+	err := r.Change(func() error {
+		if err := edit(req, r, v); err != nil {
+			discard(r)
+			return err
+		}
+		if err := r.ApplyDesc(desc); err != nil {
+			return err
+		}
+		if a != nil {
+			return a.apply(r)
+		}
+		return nil
+	})
+	if err != nil {
+		handleError(res, err)
+		return
+	}
+	syncIndex(idx, r)
+	res.Redirect(fmt.Sprintf("/%s", r.Id()))
+}
+
+// edit applies the posted files and commits them when anything is changed.
+func edit(req *http.Request, r repo.Repo, v *Visitor) error {
+	removes := map[string]bool{}
+	for _, name := range req.Form["x"] {
+		removes[name] = true
+	}
+
+	names, contents := req.Form["n"], req.Form["c"]
+	nlen, clen := len(names), len(contents)
+	for index, original := range req.Form["o"] {
+		if nlen <= index || clen <= index {
+			break
+		}
+		name, content := names[index], contents[index]
+		if err := apply(r, original, name, content, removes[original]); err != nil {
+			return err
+		}
+	}
+
+	if staged, err := r.Staged(); err != nil || staged == false {
+		return err
+	}
+	name, email := "", ""
+	if v.Anonymous() == false {
+		name, email = v.User.Name, v.User.Email
+	}
+	return r.Commit(name, email)
+}
+
+// discard resets r after a failed edit, so that its leftovers never go into the next commit.
+func discard(r repo.Repo) {
+	if err := r.Reset(); err != nil {
+		log.Errorf("fail to reset %s: %v", r.Id(), err)
+	}
+}
+
+// manageable reports whether the visitor decides who may access r.
+func manageable(r repo.Repo, v *Visitor, c config.Config) (bool, error) {
+	return acl.New(c).Manageable(writer(v), r)
+}
+
+// access is the posted visibility, the readers and the writers.
+type access struct {
+	visibility       repo.Visibility
+	readers, writers []string
+}
+
+// parseAccess reads the visibility, the readers and the writers, one per line.
+func parseAccess(req *http.Request) (*access, error) {
+	visibility, err := repo.ParseVisibility(req.FormValue("visibility"))
+	if err != nil {
+		return nil, err
+	}
+	readers, err := acl.ParseEntries(req.FormValue("readers"))
+	if err != nil {
+		return nil, err
+	}
+	writers, err := acl.ParseEntries(req.FormValue("writers"))
+	if err != nil {
+		return nil, err
+	}
+	return &access{visibility, readers, writers}, nil
+}
+
+func (a *access) apply(r repo.Repo) error {
+	if err := r.ApplyVisibility(a.visibility); err != nil {
+		return err
+	}
+	if err := r.ApplyReaders(a.readers); err != nil {
+		return err
+	}
+	return r.ApplyWriters(a.writers)
+}
+
+// apply changes a file, unchanged files are left as they are.
+func apply(r repo.Repo, original, name, content string, remove bool) error {
+	switch {
+	case len(original) < 1:
+		if 0 < len(name) {
+			return r.Add(name, content)
+		}
+		return nil
+	case remove || len(name) < 1:
+		return r.Remove(original)
+	}
+	old, err := r.Show(repo.Head, original)
+	if err != nil {
+		return err
+	}
+	content = lineEndings(old, content)
+	if original != name {
+		if err := r.Rename(original, name); err != nil {
+			return err
+		}
+	}
+	if content == string(old) {
+		return nil
+	}
+	return r.Update(name, content)
+}
+
+// lineEndings brings the line endings of content back to the ones of old,
+// since browsers post every line of a textarea with CRLF.
+func lineEndings(old []byte, content string) string {
+	if bytes.Contains(old, []byte("\r\n")) {
+		return content
+	}
+	return strings.Replace(content, "\r\n", "\n", -1)
+}
@@ -0,0 +1,43 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"net/http"
+)
+
+func ForkEntry(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	if requireLogin(req, res, v) == false {
+		return
+	}
+	if _, ok := loadReadable(res, p, v, c); ok == false {
+		return
+	}
+	maker := repo.New(c)
+	f, err := maker.ForkRepo(p["id"], v.User.Name)
+	if err != nil {
+		handleError(res, err)
+		return
+	}
+	syncIndex(idx, f)
+	res.Redirect(fmt.Sprintf("/%s", f.Id()))
+}
@@ -0,0 +1,92 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"net/url"
+	"strings"
+)
+
+var _ = Describe("Fork", func() {
+	var (
+		s *site
+		r repo.Repo
+	)
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("way")
+		r = s.makeGist("way", repo.Public, "a.txt")
+		Expect(r.Update("a.txt", "changed")).To(BeNil())
+		Expect(r.Commit("way", "way@example.com")).To(BeNil())
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	fork := func(id string) string {
+		res := s.post("/"+id+"/fork", url.Values{"_csrf": {s.csrf()}})
+		Expect(res.StatusCode).To(Equal(302))
+		return res.Header.Get("Location")
+	}
+
+	It("clone the gist with its history", func() {
+		s.signIn("other")
+		loc := fork(r.Id())
+		Expect(loc).To(MatchRegexp(`^/[a-zA-Z0-9]+$`))
+		f, err := repo.New(s.c).LoadRepo(strings.TrimPrefix(loc, "/"))
+		Expect(err).To(BeNil())
+		Expect(f.Id()).NotTo(Equal(r.Id()))
+
+		owner, err := f.Owner()
+		Expect(err).To(BeNil())
+		Expect(owner).To(Equal("other"))
+		parent, err := f.Parent()
+		Expect(err).To(BeNil())
+		Expect(parent).To(Equal(r.Id()))
+		revs, err := f.Log()
+		Expect(err).To(BeNil())
+		Expect(revs).To(HaveLen(2))
+
+		forks, err := s.idx.Forks(r.Id(), func(*index.Gist) bool { return true })
+		Expect(err).To(BeNil())
+		Expect(forks).To(HaveLen(1))
+		Expect(forks[0].Id).To(Equal(f.Id()))
+	})
+
+	It("send anonymous visitors to the login", func() {
+		res := s.post("/"+r.Id()+"/fork", url.Values{"_csrf": {s.csrf()}})
+		Expect(res.StatusCode).To(Equal(302))
+		Expect(res.Header.Get("Location")).To(HavePrefix("/login?next="))
+		ids, err := repo.New(s.c).List()
+		Expect(err).To(BeNil())
+		Expect(ids).To(HaveLen(1))
+	})
+
+	It("hide private gists from others", func() {
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		s.signIn("other")
+		res := s.post("/"+r.Id()+"/fork", url.Values{"_csrf": {s.csrf()}})
+		Expect(res.StatusCode).To(Equal(404))
+		Expect(s.post("/missing/fork", url.Values{"_csrf": {s.csrf()}}).StatusCode).To(Equal(404))
+
+		Expect(r.ApplyReaders([]string{"user:other"})).To(BeNil())
+		Expect(fork(r.Id())).To(MatchRegexp(`^/[a-zA-Z0-9]+$`))
+	})
+})
@@ -0,0 +1,138 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"io"
+	"net/http"
+)
+
+// InfoRefs advertises the refs of a repository for the smart HTTP protocol.
+func InfoRefs(w http.ResponseWriter, req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	s, err := repo.ParseService(req.URL.Query().Get("service"))
+	if err != nil {
+		// the dumb protocol is not supported.
+		res.Error(403)
+		return
+	}
+	r, ok := loadPackRepo(w, res, p, v, c, s)
+	if ok == false {
+		return
+	}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", s))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	io.WriteString(w, pktLine(fmt.Sprintf("# service=%s\n", s)))
+	io.WriteString(w, "0000")
+	if err := r.Pack(s, nil, w, "--stateless-rpc", "--advertise-refs"); err != nil {
+		log.Error(err)
+	}
+}
+
+// ServicePack runs a stateless upload-pack or receive-pack for the smart HTTP protocol.
+func ServicePack(w http.ResponseWriter, req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	s, err := repo.ParseService(p["service"])
+	if err != nil {
+		handleNotFound(res, err)
+		return
+	}
+	r, ok := loadPackRepo(w, res, p, v, c, s)
+	if ok == false {
+		return
+	}
+
+	body := io.Reader(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			res.Error(400)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if s == repo.ReceivePack {
+		if err := idx.Mark(r.Id()); err != nil {
+			handleError(res, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", s))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	if err := r.Pack(s, body, w, "--stateless-rpc"); err != nil {
+		log.Error(err)
+		return
+	}
+	if s == repo.ReceivePack {
+		syncIndex(idx, r)
+	}
+}
+
+// loadPackRepo loads the repository which the visitor may read and, for pushes, write.
+// Hidden gists ask anonymous clients for credentials, so git prompts before it gives up.
+func loadPackRepo(w http.ResponseWriter, res render.Render, p martini.Params, v *Visitor, c config.Config, s repo.PackService) (repo.Repo, bool) {
+	a := acl.New(c)
+	r, err := a.Load(reader(v), p["id"])
+	if err == acl.NotFound {
+		if v.Err != nil || v.Anonymous() {
+			requireBasicAuth(w)
+		} else {
+			handleNotFound(res, err)
+		}
+		return nil, false
+	} else if err != nil {
+		handleError(res, err)
+		return nil, false
+	}
+	if s != repo.ReceivePack {
+		return r, true
+	}
+
+	if v.Err != nil || v.Anonymous() {
+		requireBasicAuth(w)
+		return nil, false
+	}
+	if ok, err := a.Writable(writer(v), r); err != nil {
+		handleError(res, err)
+		return nil, false
+	} else if ok == false {
+		res.Error(403)
+		return nil, false
+	}
+	return r, true
+}
+
+func requireBasicAuth(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="gotive"`)
+	http.Error(w, "Unauthorized", 401)
+}
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
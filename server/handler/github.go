@@ -0,0 +1,518 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/lang"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"time"
+)
+
+// the subset of GitHub Gist API v3 served under /api/v3, so existing gist tools work against gotive.
+
+type githubUser struct {
+	Login   string `json:"login"`
+	Id      int    `json:"id"`
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	HtmlURL string `json:"html_url"`
+}
+
+type githubFile struct {
+	Filename  string `json:"filename"`
+	Type      string `json:"type"`
+	Language  string `json:"language,omitempty"`
+	RawURL    string `json:"raw_url"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+	Content   string `json:"content,omitempty"`
+}
+
+type githubChangeStatus struct {
+	Total     int `json:"total"`
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+type githubCommit struct {
+	URL          string             `json:"url"`
+	Version      string             `json:"version"`
+	User         *githubUser        `json:"user"`
+	ChangeStatus githubChangeStatus `json:"change_status"`
+	CommittedAt  time.Time          `json:"committed_at"`
+}
+
+type githubGist struct {
+	URL         string                `json:"url"`
+	ForksURL    string                `json:"forks_url"`
+	CommitsURL  string                `json:"commits_url"`
+	Id          string                `json:"id"`
+	GitPullURL  string                `json:"git_pull_url"`
+	GitPushURL  string                `json:"git_push_url"`
+	HtmlURL     string                `json:"html_url"`
+	Files       map[string]githubFile `json:"files"`
+	Public      bool                  `json:"public"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+	Description string                `json:"description"`
+	Comments    int                   `json:"comments"`
+	Owner       *githubUser           `json:"owner"`
+	Truncated   bool                  `json:"truncated"`
+	History     []githubCommit        `json:"history,omitempty"`
+	ForkOf      *githubGist           `json:"fork_of,omitempty"`
+}
+
+type githubFork struct {
+	URL       string      `json:"url"`
+	Id        string      `json:"id"`
+	User      *githubUser `json:"user"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+func GithubUser(req *http.Request, res render.Render, v *Visitor) {
+	u, err := requireUser(v, token.Read)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.JSON(200, toGithubUser(req, u.Name))
+}
+
+// GithubGists lists gists of the authenticated user including secret ones, or public gists for anonymous.
+func GithubGists(req *http.Request, res render.Render, v *Visitor, c config.Config, idx *index.Index) {
+	u, err := apiUser(v, token.Read)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if u == nil {
+		listGithubGists(req, res, c, idx, nil, listed)
+		return
+	}
+	listGithubGists(req, res, c, idx, u, ownedBy(u.Name))
+}
+
+func GithubPublicGists(req *http.Request, res render.Render, c config.Config, idx *index.Index) {
+	listGithubGists(req, res, c, idx, nil, listed)
+}
+
+// GithubUserGists lists public gists of the user, secret ones are listed only for the user.
+func GithubUserGists(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	u, err := apiUser(v, token.Read)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	owned := ownedBy(p["user"])
+	if u != nil && u.Name == p["user"] {
+		listGithubGists(req, res, c, idx, u, owned)
+		return
+	}
+	listGithubGists(req, res, c, idx, nil, func(g *index.Gist) bool { return owned(g) && listed(g) })
+}
+
+func GithubStarredGists(req *http.Request, res render.Render, v *Visitor, c config.Config, idx *index.Index) {
+	u, err := requireUser(v, token.Read)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	a := acl.New(c)
+	listGithubGists(req, res, c, idx, u, func(g *index.Gist) bool {
+		if u.Starred(g.Id) == false {
+			return false
+		}
+		// access may have been taken away after starring
+		_, err := a.Load(u, g.Id)
+		return err == nil
+	})
+}
+
+// listGithubGists lists a page of the gists which pass filter, and which u may read now, or public ones only for nil.
+func listGithubGists(req *http.Request, res render.Render, c config.Config, idx *index.Index, u *user.User, filter func(g *index.Gist) bool) {
+	listing, err := idx.List(filter)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	page, err := paginate(req, len(listing))
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	gists := []githubGist{}
+	for _, g := range current(c, u, listing[page.from:page.to]) {
+		gists = append(gists, indexedGithubGist(req, g))
+	}
+	page.links(req, res.Header())
+	res.JSON(200, gists)
+}
+
+func GithubGist(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	r, err := loadAPIRepo(v, c, p["id"])
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	rev := repo.Head
+	if sha, ok := p["sha"]; ok {
+		if rev, err = r.Resolve(sha); err != nil {
+			handleAPIError(res, failure(404, "Not Found"))
+			return
+		}
+	}
+	g, err := toGithubGist(req, c, r, rev, true)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.JSON(200, g)
+}
+
+func GithubCreateGist(req *http.Request, res render.Render, v *Visitor, c config.Config, idx *index.Index) {
+	u, err := requireUser(v, token.Write)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	change, err := decodeChange(req)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if len(change.Files) < 1 {
+		handleAPIError(res, failure(422, "files are required"))
+		return
+	}
+
+	maker := repo.New(c)
+	r, err := maker.MakeRepo()
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := idx.Mark(r.Id()); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := createGist(r, u, change, c); err != nil {
+		maker.RemoveRepo(r.Id())
+		handleAPIError(res, err)
+		return
+	}
+	syncIndex(idx, r)
+	g, err := toGithubGist(req, c, r, repo.Head, true)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.Header().Set("Location", g.URL)
+	res.JSON(201, g)
+}
+
+func GithubEditGist(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	r, u, err := loadWritableRepo(v, c, p["id"])
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	change, err := decodeChange(req)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := idx.Mark(r.Id()); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if err := r.Change(func() error { return editGist(r, u, change) }); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	syncIndex(idx, r)
+	g, err := toGithubGist(req, c, r, repo.Head, true)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.JSON(200, g)
+}
+
+func GithubCommits(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	r, err := loadAPIRepo(v, c, p["id"])
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	revs, err := r.Log()
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	page, err := paginate(req, len(revs))
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	page.links(req, res.Header())
+	res.JSON(200, toGithubCommits(req, r, revs[page.from:page.to]))
+}
+
+func GithubFork(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	u, err := requireUser(v, token.Write)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if _, err := loadRepoFor(u, c, p["id"]); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	f, err := repo.New(c).ForkRepo(p["id"], u.Name)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	syncIndex(idx, f)
+	g, err := toGithubGist(req, c, f, repo.Head, false)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.Header().Set("Location", g.URL)
+	res.JSON(201, g)
+}
+
+func GithubForks(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, idx *index.Index) {
+	if _, err := loadAPIRepo(v, c, p["id"]); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	listing, err := idx.Forks(p["id"], listed)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	page, err := paginate(req, len(listing))
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	forks := []githubFork{}
+	for _, f := range current(c, nil, listing[page.from:page.to]) {
+		g := indexedGithubGist(req, f)
+		forks = append(forks, githubFork{URL: g.URL, Id: g.Id, User: g.Owner, CreatedAt: g.CreatedAt, UpdatedAt: g.UpdatedAt})
+	}
+	page.links(req, res.Header())
+	res.JSON(200, forks)
+}
+
+func GithubStarred(res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	u, err := requireUser(v, token.Read)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	// access may have been taken away after starring
+	if _, err := loadRepoFor(u, c, p["id"]); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if u.Starred(p["id"]) {
+		res.Status(204)
+		return
+	}
+	handleAPIError(res, failure(404, "Not Found"))
+}
+
+func GithubStar(res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	star(res, p, v, c, (*user.User).Star)
+}
+
+func GithubUnstar(res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	star(res, p, v, c, (*user.User).Unstar)
+}
+
+func star(res render.Render, p martini.Params, v *Visitor, c config.Config, fn func(u *user.User, id string)) {
+	u, err := requireUser(v, token.Write)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if _, err := loadRepoFor(u, c, p["id"]); err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	// the credentials may not carry every role of the user, so the stored user is changed.
+	_, err = user.New(c).Update(u.Name, func(stored *user.User) error {
+		fn(stored, p["id"])
+		return nil
+	})
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	res.Status(204)
+}
+
+// toGithubUser describes the owner of gists, which may be an organization.
+func toGithubUser(req *http.Request, name string) *githubUser {
+	if len(name) < 1 {
+		return nil
+	}
+	if o, ok := org.ParseOwner(name); ok {
+		return &githubUser{
+			Login:   o,
+			Type:    "Organization",
+			URL:     absURL(req, "/api/v3/orgs/%s", o),
+			HtmlURL: absURL(req, "/org/%s", o),
+		}
+	}
+	return &githubUser{
+		Login:   name,
+		Type:    "User",
+		URL:     absURL(req, "/api/v3/users/%s", name),
+		HtmlURL: absURL(req, "/"),
+	}
+}
+
+func newGithubGist(req *http.Request, id string) githubGist {
+	return githubGist{
+		URL:        absURL(req, "/api/v3/gists/%s", id),
+		ForksURL:   absURL(req, "/api/v3/gists/%s/forks", id),
+		CommitsURL: absURL(req, "/api/v3/gists/%s/commits", id),
+		Id:         id,
+		GitPullURL: absURL(req, "/%s.git", id),
+		GitPushURL: absURL(req, "/%s.git", id),
+		HtmlURL:    absURL(req, "/%s", id),
+		Files:      map[string]githubFile{},
+	}
+}
+
+// indexedGithubGist describes g as the index knows it, so listings never read repositories.
+func indexedGithubGist(req *http.Request, g *index.Gist) githubGist {
+	h := newGithubGist(req, g.Id)
+	h.Description = g.Description
+	h.Public = g.Visibility == repo.Public
+	h.Owner = toGithubUser(req, g.Owner)
+	h.CreatedAt, h.UpdatedAt = g.Created, g.Updated
+	for _, f := range g.Files {
+		h.Files[f.Name] = githubFile{
+			Filename: f.Name,
+			Type:     f.Type,
+			Language: f.Language,
+			RawURL:   absURL(req, "/%s/%s/raw/%s", g.Id, g.Revision, f.Name),
+			Size:     f.Size,
+		}
+	}
+	return h
+}
+
+func toGithubGist(req *http.Request, c config.Config, r repo.Repo, rev string, withContent bool) (githubGist, error) {
+	id := r.Id()
+	g := newGithubGist(req, id)
+	var err error
+	if g.Description, err = r.Desc(); err != nil {
+		return g, err
+	}
+	visibility, err := r.Visibility()
+	if err != nil {
+		return g, err
+	}
+	g.Public = visibility == repo.Public
+	owner, err := r.Owner()
+	if err != nil {
+		return g, err
+	}
+	g.Owner = toGithubUser(req, owner)
+
+	revs, err := r.Log()
+	if err != nil {
+		return g, err
+	}
+	if len(revs) < 1 {
+		return g, nil
+	}
+	g.CreatedAt, g.UpdatedAt = revs[len(revs)-1].Date, revs[0].Date
+	if withContent {
+		g.History = toGithubCommits(req, r, revs)
+		if parent, err := r.Parent(); err == nil && 0 < len(parent) {
+			// a private parent is never revealed through its forks
+			if pr, err := acl.New(c).Load(nil, parent); err == nil {
+				if pg, err := toGithubGist(req, c, pr, repo.Head, false); err == nil {
+					g.ForkOf = &pg
+				}
+			}
+		}
+	}
+
+	sha, err := r.Resolve(rev)
+	if err != nil {
+		return g, err
+	}
+	files, err := r.Files(sha)
+	if err != nil {
+		return g, err
+	}
+	for _, name := range files {
+		b, err := r.Show(sha, name)
+		if err != nil {
+			return g, err
+		}
+		f := githubFile{
+			Filename: name,
+			Type:     index.ContentType(b),
+			Language: lang.Detect(name, b),
+			RawURL:   absURL(req, "/%s/%s/raw/%s", id, sha, name),
+			Size:     len(b),
+		}
+		if withContent {
+			f.Content = string(b)
+		}
+		g.Files[name] = f
+	}
+	return g, nil
+}
+
+func toGithubCommits(req *http.Request, r repo.Repo, revs []repo.Revision) []githubCommit {
+	commits := []githubCommit{}
+	for _, rev := range revs {
+		status := githubChangeStatus{}
+		for _, f := range rev.Files {
+			status.Additions += f.Added
+			status.Deletions += f.Removed
+		}
+		status.Total = status.Additions + status.Deletions
+		commits = append(commits, githubCommit{
+			URL:          absURL(req, "/api/v3/gists/%s/%s", r.Id(), rev.Id),
+			Version:      rev.Id,
+			User:         toGithubUser(req, rev.Author),
+			ChangeStatus: status,
+			CommittedAt:  rev.Date,
+		})
+	}
+	return commits
+}
@@ -0,0 +1,146 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"strings"
+	"time"
+)
+
+var _ = Describe("GitHub API", func() {
+	var s *site
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("way")
+		s.makeUser("other")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	It("create and edit gists like GitHub", func() {
+		res := s.send("POST", "/api/v3/gists", map[string]interface{}{
+			"description": "hello",
+			"public":      false,
+			"files":       map[string]interface{}{"hello.go": map[string]string{"content": "package main"}},
+		}, basic("way"))
+		Expect(res.StatusCode).To(Equal(201))
+		created := struct {
+			Id         string
+			GitPullURL string `json:"git_pull_url"`
+			Public     bool
+			Owner      struct{ Login string }
+			Files      map[string]struct{ Language string }
+		}{}
+		decode(res, &created)
+		Expect(created.Public).To(BeFalse())
+		Expect(created.Files["hello.go"].Language).To(Equal("Go"))
+		Expect(created.Owner.Login).To(Equal("way"))
+		Expect(created.GitPullURL).To(Equal(s.server.URL + "/" + created.Id + ".git"))
+
+		res = s.send("PATCH", "/api/v3/gists/"+created.Id, map[string]interface{}{"description": "changed"}, basic("other"))
+		Expect(res.StatusCode).To(Equal(403))
+		res = s.send("PATCH", "/api/v3/gists/"+created.Id, map[string]interface{}{"description": "changed"}, basic("way"))
+		Expect(res.StatusCode).To(Equal(200))
+
+		commits := []map[string]interface{}{}
+		decode(s.get("/api/v3/gists/"+created.Id+"/commits"), &commits)
+		Expect(commits).To(HaveLen(1))
+		Expect(s.get("/api/v3/gists/" + created.Id + "/" + commits[0]["version"].(string)).StatusCode).To(Equal(200))
+		Expect(s.get("/api/v3/gists/" + created.Id + "/0000000").StatusCode).To(Equal(404))
+	})
+
+	It("list gists of users", func() {
+		public := s.makeGist("way", repo.Public, "a.txt")
+		s.makeGist("way", repo.Secret, "b.txt")
+		s.makeGist("other", repo.Public, "c.txt")
+
+		listing := []map[string]interface{}{}
+		decode(s.get("/api/v3/users/way/gists"), &listing)
+		Expect(listing).To(HaveLen(1))
+		Expect(listing[0]["id"]).To(Equal(public.Id()))
+
+		listing = []map[string]interface{}{}
+		decode(s.do("GET", "/api/v3/users/way/gists", nil, basic("way")), &listing)
+		Expect(listing).To(HaveLen(2))
+
+		res := s.get("/api/v3/gists/public?per_page=1")
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Link")).To(ContainSubstring(`rel="next"`))
+		Expect(s.get("/api/v3/user").StatusCode).To(Equal(401))
+	})
+
+	It("fork and star gists", func() {
+		r := s.makeGist("way", repo.Public, "a.txt")
+		Expect(s.do("POST", "/api/v3/gists/"+r.Id()+"/forks", nil, nil).StatusCode).To(Equal(401))
+		res := s.do("POST", "/api/v3/gists/"+r.Id()+"/forks", nil, basic("other"))
+		Expect(res.StatusCode).To(Equal(201))
+		fork := map[string]interface{}{}
+		decode(res, &fork)
+
+		forks := []map[string]interface{}{}
+		decode(s.get("/api/v3/gists/"+r.Id()+"/forks"), &forks)
+		Expect(forks).To(HaveLen(1))
+		Expect(forks[0]["id"]).To(Equal(fork["id"]))
+
+		star := "/api/v3/gists/" + r.Id() + "/star"
+		Expect(s.do("GET", star, nil, basic("other")).StatusCode).To(Equal(404))
+		Expect(s.do("PUT", star, nil, basic("other")).StatusCode).To(Equal(204))
+		Expect(s.do("GET", star, nil, basic("other")).StatusCode).To(Equal(204))
+		u, err := user.New(s.c).Find("other")
+		Expect(err).To(BeNil())
+		Expect(u.Starred(r.Id())).To(BeTrue())
+		// the star never reveals the gist once it is private
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		Expect(s.do("GET", star, nil, basic("other")).StatusCode).To(Equal(404))
+		Expect(r.ApplyVisibility(repo.Public)).To(BeNil())
+		Expect(s.do("DELETE", star, nil, basic("other")).StatusCode).To(Equal(204))
+		Expect(s.do("GET", star, nil, basic("other")).StatusCode).To(Equal(404))
+	})
+
+	It("keep the roles of users whom tokens limit", func() {
+		u := s.makeUser("admin")
+		u.Roles = []string{user.AdminRole}
+		Expect(user.New(s.c).Save(u)).To(BeNil())
+		secret, _, err := token.New(s.c).Mint(u, "spec", []string{token.Write}, time.Time{})
+		Expect(err).To(BeNil())
+
+		r := s.makeGist("way", repo.Public, "a.txt")
+		Expect(s.do("PUT", "/api/v3/gists/"+r.Id()+"/star", nil, bearer(secret)).StatusCode).To(Equal(204))
+		found, err := user.New(s.c).Find("admin")
+		Expect(err).To(BeNil())
+		Expect(found.Starred(r.Id())).To(BeTrue())
+		Expect(found.HasRole(user.AdminRole)).To(BeTrue())
+	})
+
+	It("hide private gists as missing ones", func() {
+		r := s.makeGist("way", repo.Private, "a.txt")
+		for _, path := range []string{"", "/commits", "/forks"} {
+			Expect(s.get("/api/v3/gists/" + r.Id() + path).StatusCode).To(Equal(404))
+			Expect(s.do("GET", "/api/v3/gists/"+r.Id()+path, nil, basic("other")).StatusCode).To(Equal(404))
+			Expect(s.do("GET", "/api/v3/gists/"+r.Id()+path, nil, basic("way")).StatusCode).To(Equal(200))
+		}
+		Expect(s.do("POST", "/api/v3/gists/"+r.Id()+"/forks", nil, basic("other")).StatusCode).To(Equal(404))
+		Expect(s.do("PUT", "/api/v3/gists/"+r.Id()+"/star", nil, basic("other")).StatusCode).To(Equal(404))
+		Expect(s.do("DELETE", "/api/v3/gists/"+r.Id(), nil, basic("other")).StatusCode).To(Equal(404))
+		Expect(strings.Contains(text(s.get("/api/v3/gists/public")), r.Id())).To(BeFalse())
+	})
+})
@@ -15,10 +15,70 @@
  */
 package handler
 
-import "github.com/codegangsta/martini"
+import (
+	"github.com/codegangsta/martini"
+	"html/template"
+)
+
+const sha = `(?P<sha>[0-9a-f]{7,40})`
+
+// Funcs are the functions which templates call.
+var Funcs = template.FuncMap{
+	"markdown": markdownText,
+}
 
 func AddHandlers(router martini.Router) {
+	router.Get(`/(?P<id>[a-zA-Z0-9]+)\.git/info/refs`, InfoRefs)
+	router.Post(`/(?P<id>[a-zA-Z0-9]+)\.git/(?P<service>git-upload-pack|git-receive-pack)`, ServicePack)
+	router.Get("/api/v1/gists", ListGists)
+	router.Post("/api/v1/gists", CreateGist)
+	router.Get("/api/v1/gists/:id", GetGist)
+	router.Patch("/api/v1/gists/:id", EditGist)
+	router.Delete("/api/v1/gists/:id", DeleteGist)
+	router.Get("/api/v1/search", SearchGists)
+	router.Get("/api/v3/user", GithubUser)
+	router.Get("/api/v3/users/:user/gists", GithubUserGists)
+	router.Get("/api/v3/gists", GithubGists)
+	router.Post("/api/v3/gists", GithubCreateGist)
+	router.Get("/api/v3/gists/public", GithubPublicGists)
+	router.Get("/api/v3/gists/starred", GithubStarredGists)
+	router.Get("/api/v3/gists/:id", GithubGist)
+	router.Patch("/api/v3/gists/:id", GithubEditGist)
+	router.Delete("/api/v3/gists/:id", DeleteGist)
+	router.Get("/api/v3/gists/:id/commits", GithubCommits)
+	router.Get("/api/v3/gists/:id/forks", GithubForks)
+	router.Post("/api/v3/gists/:id/forks", GithubFork)
+	router.Get("/api/v3/gists/:id/star", GithubStarred)
+	router.Put("/api/v3/gists/:id/star", GithubStar)
+	router.Delete("/api/v3/gists/:id/star", GithubUnstar)
+	router.Get("/api/v3/gists/:id/"+sha, GithubGist)
+	router.Get("/signup", SignupForm)
+	router.Post("/signup", CheckCSRF, Signup)
+	router.Get("/login", LoginForm)
+	router.Post("/login", CheckCSRF, Login)
+	router.Post("/logout", CheckCSRF, Logout)
+	router.Get("/login/sso", SSOLogin)
+	router.Get("/login/sso/callback", SSOCallback)
+	router.Get("/settings/tokens", Tokens)
+	router.Post("/settings/tokens", CheckCSRF, MintToken)
+	router.Post("/settings/tokens/:token/revoke", CheckCSRF, RevokeToken)
+	router.Get("/discover", Discover)
+	router.Get("/search", Search)
+	router.Get("/highlight.css", HighlightCSS)
+	router.Get("/orgs/new", NewOrgForm)
+	router.Post("/orgs/new", CheckCSRF, CreateOrg)
+	router.Get("/org/:name", OrgPage)
+	router.Post("/org/:name", CheckCSRF, UpdateOrg)
 	router.Get("/", Index)
-	router.Post("/new", NewEntry)
+	router.Post("/new", CheckCSRF, NewEntry)
 	router.Get("/:id", ViewEntry)
+	router.Get("/:id/edit", EditEntry)
+	router.Post("/:id/edit", CheckCSRF, UpdateEntry)
+	router.Get("/:id/raw/**", RawFile)
+	router.Get(`/:id/archive/(?P<rev>[^/]+?)\.(?P<format>zip|tar\.gz)`, Archive)
+	router.Get("/:id/revisions", Revisions)
+	router.Post("/:id/fork", CheckCSRF, ForkEntry)
+	router.Get(`/:id/compare/(?P<from>[^/.]+)\.\.\.(?P<to>[^/.]+)`, Compare)
+	router.Get("/:id/"+sha, ViewRevision)
+	router.Get("/:id/"+sha+"/raw/**", RawRevision)
 }
@@ -0,0 +1,216 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/ginkgo"
+	"github.com/taichi/gotive/server/handler"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/sso"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	RegisterFailHandler(Fail)
+	Configure()
+	RunSpecs(t, "Handler Suite")
+}
+
+// site is a gotive server on temporary directories, its client keeps cookies but never follows redirects.
+type site struct {
+	c      config.Config
+	idx    *index.Index
+	server *httptest.Server
+	client *http.Client
+	root   string
+}
+
+// newSite starts a server like server.Start does, configure may change the config before.
+func newSite(configure func(c config.Config)) *site {
+	root, err := ioutil.TempDir(os.TempDir(), "handler")
+	Expect(err).To(BeNil())
+	c := config.New()
+	c.Repo = filepath.Join(root, "repo")
+	c.Users = filepath.Join(root, "users")
+	c.Tokens = filepath.Join(root, "tokens")
+	c.Orgs = filepath.Join(root, "orgs")
+	c.Index = filepath.Join(root, "index.db")
+	if configure != nil {
+		configure(c)
+	}
+	p, err := sso.New(context.Background(), c)
+	Expect(err).To(BeNil())
+	idx, err := index.Open(c)
+	Expect(err).To(BeNil())
+
+	m := martini.Classic()
+	m.Use(render.Renderer(render.Options{
+		Directory:  "../template",
+		Layout:     "layout",
+		Extensions: []string{".tmpl", ".html"},
+		Funcs:      []template.FuncMap{handler.Funcs},
+	}))
+	m.Map(c)
+	m.Use(sessions.Sessions("gotive", sessions.NewCookieStore([]byte("secret"))))
+	m.Use(handler.Authenticate)
+	m.Map(p)
+	m.Map(idx)
+	handler.AddHandlers(m)
+
+	s := &site{c: c, idx: idx, server: httptest.NewServer(m), root: root}
+	s.forget()
+	return s
+}
+
+func (s *site) close() {
+	s.server.Close()
+	Expect(s.idx.Close()).To(BeNil())
+	Expect(osutil.ForceRemoveAll(s.root)).To(BeNil())
+}
+
+// forget drops the cookies, so the next request comes from a new visitor.
+func (s *site) forget() {
+	jar, err := cookiejar.New(nil)
+	Expect(err).To(BeNil())
+	s.client = &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (s *site) do(method, path string, body io.Reader, header http.Header) *http.Response {
+	req, err := http.NewRequest(method, s.server.URL+path, body)
+	Expect(err).To(BeNil())
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := s.client.Do(req)
+	Expect(err).To(BeNil())
+	return res
+}
+
+func (s *site) get(path string) *http.Response {
+	return s.do("GET", path, nil, nil)
+}
+
+// post sends form as the browser does, the CSRF token is up to the caller.
+func (s *site) post(path string, form url.Values) *http.Response {
+	return s.do("POST", path, strings.NewReader(form.Encode()), http.Header{"Content-Type": {"application/x-www-form-urlencoded"}})
+}
+
+var csrfField = regexp.MustCompile(`name="_csrf" value="([0-9a-f]+)"`)
+
+// csrf returns the CSRF token of the session, which forms carry.
+func (s *site) csrf() string {
+	m := csrfField.FindStringSubmatch(text(s.get("/login")))
+	Expect(m).To(HaveLen(2))
+	return m[1]
+}
+
+// makeUser makes a local user of name, whose password is "password".
+func (s *site) makeUser(name string) *user.User {
+	u := &user.User{Name: name, Email: name + "@example.com"}
+	Expect(u.SetPassword("password")).To(BeNil())
+	if err := user.New(s.c).Create(u); err != user.UserExists {
+		Expect(err).To(BeNil())
+	}
+	return u
+}
+
+// signIn logs the visitor in as the local user of name.
+func (s *site) signIn(name string) *user.User {
+	u := s.makeUser(name)
+	res := s.post("/login", url.Values{"name": {name}, "password": {"password"}, "_csrf": {s.csrf()}})
+	Expect(res.StatusCode).To(Equal(302))
+	return u
+}
+
+// makeGist commits files to a new gist of owner and indexes it.
+func (s *site) makeGist(owner string, v repo.Visibility, files ...string) repo.Repo {
+	r, err := repo.New(s.c).MakeRepo()
+	Expect(err).To(BeNil())
+	Expect(r.ApplyOwner(owner)).To(BeNil())
+	Expect(r.ApplyVisibility(v)).To(BeNil())
+	for _, f := range files {
+		Expect(r.Add(f, "content of "+f)).To(BeNil())
+	}
+	Expect(r.Commit(owner, owner+"@example.com")).To(BeNil())
+	Expect(s.idx.Sync(r)).To(BeNil())
+	return r
+}
+
+// send sends v as JSON.
+func (s *site) send(method, path string, v interface{}, header http.Header) *http.Response {
+	b, err := json.Marshal(v)
+	Expect(err).To(BeNil())
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	return s.do(method, path, bytes.NewReader(b), header)
+}
+
+// basic returns the header to authenticate as the local user of name.
+func basic(name string) http.Header {
+	req, err := http.NewRequest("GET", "/", nil)
+	Expect(err).To(BeNil())
+	req.SetBasicAuth(name, "password")
+	return req.Header
+}
+
+// bearer returns the header to authenticate with the token.
+func bearer(secret string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + secret}}
+}
+
+// decode reads the JSON body of res into v.
+func decode(res *http.Response, v interface{}) {
+	defer res.Body.Close()
+	Expect(json.NewDecoder(res.Body).Decode(v)).To(BeNil())
+}
+
+// text reads the body of res and closes it.
+func text(res *http.Response) string {
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	Expect(err).To(BeNil())
+	return string(b)
+}
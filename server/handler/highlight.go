@@ -0,0 +1,51 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"bytes"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/highlight"
+	"net/http"
+)
+
+// highlightContent renders a file for render.html, binary files and failures are left to the plain text.
+func highlightContent(c *content) {
+	c.Anchor = highlight.Anchor(c.Name)
+	if bytes.IndexByte([]byte(c.Content), 0) != -1 {
+		c.Binary = true
+		return
+	}
+	h, err := highlight.Code(c.Lang, c.Content, c.Anchor)
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	c.HTML = h
+}
+
+// HighlightCSS serves the stylesheet of highlighted code.
+func HighlightCSS(w http.ResponseWriter, res render.Render) {
+	css, err := highlight.CSS()
+	if err != nil {
+		handleError(res, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(css)
+}
@@ -17,8 +17,22 @@ package handler
 
 import (
 	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/org"
+	"net/http"
 )
 
-func Index(res render.Render) {
-	res.HTML(200, "input", nil)
+func Index(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config) {
+	if requireLogin(req, res, v) == false {
+		return
+	}
+	model := newModel(s, v)
+	if orgs, err := org.New(c).Of(v.User.Name); err != nil {
+		handleError(res, err)
+		return
+	} else {
+		model["orgs"] = orgs
+	}
+	res.HTML(200, "input", model)
 }
@@ -0,0 +1,188 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/auth"
+	"github.com/taichi/gotive/server/sso"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func SignupForm(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config) {
+	// accounts come from the directory server
+	if auth.External(c) {
+		res.Redirect("/login?next=" + url.QueryEscape(nextPath(req)))
+		return
+	}
+	model := newModel(s, v)
+	model["next"] = nextPath(req)
+	res.HTML(200, "signup", model)
+}
+
+func Signup(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config) {
+	if auth.External(c) {
+		res.Error(403)
+		return
+	}
+	model := newModel(s, v)
+	model["next"] = nextPath(req)
+	name, email := req.FormValue("name"), req.FormValue("email")
+	password := req.FormValue("password")
+	model["name"], model["email"] = name, email
+
+	fail := func(message string) {
+		model["error"] = message
+		res.HTML(400, "signup", model)
+	}
+	switch {
+	case user.ValidName(name) == false:
+		fail("Name may only contain alphanumeric characters, hyphens and underscores.")
+		return
+	case strings.Contains(email, "@") == false:
+		fail("Email is invalid.")
+		return
+	case len(password) < 8:
+		fail("Password must be at least 8 characters.")
+		return
+	case password != req.FormValue("confirm"):
+		fail("Password does not match the confirmation.")
+		return
+	}
+
+	u := &user.User{Name: name, Email: email}
+	if err := u.SetPassword(password); err != nil {
+		handleError(res, err)
+		return
+	}
+	if err := user.New(c).Create(u); err == user.UserExists {
+		fail("Name is already taken.")
+		return
+	} else if err != nil {
+		handleError(res, err)
+		return
+	}
+	login(s, u)
+	res.Redirect(nextPath(req))
+}
+
+func LoginForm(req *http.Request, res render.Render, s sessions.Session, v *Visitor, p *sso.Provider) {
+	model := newModel(s, v)
+	model["next"] = nextPath(req)
+	model["sso"] = p != nil
+	res.HTML(200, "login", model)
+}
+
+func Login(req *http.Request, res render.Render, s sessions.Session, v *Visitor, p *sso.Provider, c config.Config) {
+	u, err := auth.New(c).Authenticate(req.FormValue("name"), req.FormValue("password"))
+	if err != nil {
+		if err != user.FailToAuthenticate && err != user.UserNotFound {
+			log.Warn(err)
+		}
+		model := newModel(s, v)
+		model["next"] = nextPath(req)
+		model["sso"] = p != nil
+		model["name"] = req.FormValue("name")
+		model["error"] = "Incorrect name or password."
+		res.HTML(401, "login", model)
+		return
+	}
+	login(s, u)
+	res.Redirect(nextPath(req))
+}
+
+func Logout(res render.Render, s sessions.Session) {
+	s.Clear()
+	res.Redirect("/")
+}
+
+// SSOLogin sends the visitor to the single sign-on provider.
+func SSOLogin(req *http.Request, res render.Render, s sessions.Session, p *sso.Provider) {
+	if p == nil {
+		res.Error(404)
+		return
+	}
+	state, nonce, verifier := sso.Random(), sso.Random(), sso.Random()
+	s.Set("sso.state", state)
+	s.Set("sso.nonce", nonce)
+	s.Set("sso.verifier", verifier)
+	s.Set("sso.next", nextPath(req))
+	res.Redirect(p.AuthCodeURL(state, nonce, verifier))
+}
+
+// SSOCallback receives the authorization code and logs the mapped user in.
+func SSOCallback(req *http.Request, res render.Render, s sessions.Session, p *sso.Provider, c config.Config) {
+	if p == nil {
+		res.Error(404)
+		return
+	}
+	state, _ := s.Get("sso.state").(string)
+	nonce, _ := s.Get("sso.nonce").(string)
+	verifier, _ := s.Get("sso.verifier").(string)
+	next, _ := s.Get("sso.next").(string)
+	for _, key := range []string{"sso.state", "sso.nonce", "sso.verifier", "sso.next"} {
+		s.Delete(key)
+	}
+
+	q := req.URL.Query()
+	if len(state) < 1 || q.Get("state") != state {
+		res.Error(400)
+		return
+	}
+	if e := q.Get("error"); 0 < len(e) {
+		log.Debugf("sso error %s %s", e, q.Get("error_description"))
+		res.Error(401)
+		return
+	}
+	id, err := p.Exchange(req.Context(), q.Get("code"), verifier, nonce)
+	if err != nil {
+		log.Debug(err)
+		res.Error(401)
+		return
+	}
+	u, err := sso.Map(user.New(c), id)
+	if err != nil {
+		log.Warn(err)
+		res.Error(403)
+		return
+	}
+	login(s, u)
+	if len(next) < 1 {
+		next = "/"
+	}
+	res.Redirect(next)
+}
+
+func login(s sessions.Session, u *user.User) {
+	// start a fresh session, so nothing from before the login survives.
+	s.Clear()
+	s.Set("user", u.Name)
+}
+
+// nextPath returns where to go after login, only paths on this site are allowed.
+func nextPath(req *http.Request) string {
+	next := req.FormValue("next")
+	if strings.HasPrefix(next, "/") == false || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,252 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/sso"
+	"github.com/taichi/gotive/server/user"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+)
+
+// issuer is an OpenID Connect provider for specs, which serves discovery, keys and tokens.
+type issuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// requests are the authorization requests by code.
+	requests map[string]url.Values
+	// nonce replaces the nonce of id tokens when given.
+	nonce string
+	// ttl is the lifetime of id tokens.
+	ttl time.Duration
+}
+
+func newIssuer() *issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).To(BeNil())
+	is := &issuer{key: key, requests: map[string]url.Values{}, ttl: time.Hour}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		reply(w, 200, map[string]interface{}{
+			"issuer":                                is.server.URL,
+			"authorization_endpoint":                is.server.URL + "/authorize",
+			"token_endpoint":                        is.server.URL + "/token",
+			"jwks_uri":                              is.server.URL + "/keys",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, req *http.Request) {
+		reply(w, 200, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   encode(key.N.Bytes()),
+				"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", is.token)
+	is.server = httptest.NewServer(mux)
+	return is
+}
+
+func (is *issuer) close() {
+	is.server.Close()
+}
+
+// authorize approves the authorization request at loc, and returns where the browser is sent back.
+func (is *issuer) authorize(loc *url.URL) string {
+	q := loc.Query()
+	Expect(q.Get("client_id")).To(Equal("gotive"))
+	code := sso.Random()
+	is.requests[code] = q
+	return "/login/sso/callback?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+}
+
+// token redeems a code only with the code verifier of its challenge.
+func (is *issuer) token(w http.ResponseWriter, req *http.Request) {
+	id, secret, ok := req.BasicAuth()
+	if ok == false {
+		id, secret = req.FormValue("client_id"), req.FormValue("client_secret")
+	}
+	if id != "gotive" || secret != "secret" {
+		reply(w, 401, map[string]string{"error": "invalid_client"})
+		return
+	}
+	q, ok := is.requests[req.FormValue("code")]
+	sum := sha256.Sum256([]byte(req.FormValue("code_verifier")))
+	if ok == false || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != encode(sum[:]) {
+		reply(w, 400, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	delete(is.requests, req.FormValue("code"))
+
+	nonce := q.Get("nonce")
+	if 0 < len(is.nonce) {
+		nonce = is.nonce
+	}
+	now := time.Now()
+	reply(w, 200, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token": is.sign(map[string]interface{}{
+			"iss":                is.server.URL,
+			"sub":                "1234",
+			"aud":                "gotive",
+			"iat":                now.Add(is.ttl - time.Hour).Unix(),
+			"exp":                now.Add(is.ttl).Unix(),
+			"nonce":              nonce,
+			"preferred_username": "way",
+			"email":              "way@example.com",
+		}),
+	})
+}
+
+// sign makes a JWS of claims with RS256.
+func (is *issuer) sign(claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	Expect(err).To(BeNil())
+	signing := encode([]byte(`{"alg":"RS256","kid":"test"}`)) + "." + encode(payload)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, is.key, crypto.SHA256, sum[:])
+	Expect(err).To(BeNil())
+	return signing + "." + encode(sig)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+var _ = Describe("Single sign-on", func() {
+	var (
+		is *issuer
+		s  *site
+	)
+	BeforeEach(func() {
+		is = newIssuer()
+		s = newSite(func(c config.Config) {
+			c.OIDC.Issuer = is.server.URL
+			c.OIDC.ClientId = "gotive"
+			c.OIDC.ClientSecret = "secret"
+			c.OIDC.RedirectURL = "http://gist.example.com/login/sso/callback"
+		})
+	})
+	AfterEach(func() {
+		s.close()
+		is.close()
+	})
+
+	// login starts the flow and returns the authorization request.
+	login := func() *url.URL {
+		res := s.get("/login/sso?next=/discover")
+		Expect(res.StatusCode).To(Equal(302))
+		loc, err := url.Parse(res.Header.Get("Location"))
+		Expect(err).To(BeNil())
+		return loc
+	}
+	loggedIn := func() bool {
+		return s.get("/settings/tokens").StatusCode == 200
+	}
+
+	It("log users in with the authorization code flow and PKCE", func() {
+		loc := login()
+		Expect(loc.String()).To(HavePrefix(is.server.URL + "/authorize?"))
+		q := loc.Query()
+		Expect(q.Get("response_type")).To(Equal("code"))
+		Expect(q.Get("code_challenge_method")).To(Equal("S256"))
+		Expect(q.Get("code_challenge")).To(HaveLen(43))
+		Expect(q.Get("code_verifier")).To(BeEmpty())
+		Expect(q.Get("state")).NotTo(BeEmpty())
+		Expect(q.Get("nonce")).NotTo(BeEmpty())
+
+		res := s.get(is.authorize(loc))
+		Expect(res.StatusCode).To(Equal(302))
+		Expect(res.Header.Get("Location")).To(Equal("/discover"))
+		Expect(loggedIn()).To(BeTrue())
+
+		u, err := user.New(s.c).FindBySubject(is.server.URL + "#1234")
+		Expect(err).To(BeNil())
+		Expect(u.Name).To(Equal("way"))
+		Expect(u.Email).To(Equal("way@example.com"))
+	})
+
+	It("reject codes issued for another code challenge", func() {
+		loc := login()
+		q := loc.Query()
+		q.Set("code_challenge", encode(make([]byte, 32)))
+		loc.RawQuery = q.Encode()
+		Expect(s.get(is.authorize(loc)).StatusCode).To(Equal(401))
+		Expect(loggedIn()).To(BeFalse())
+	})
+
+	It("reject a state which the session did not start", func() {
+		loc := login()
+		q := loc.Query()
+		q.Set("state", "forged")
+		loc.RawQuery = q.Encode()
+		Expect(s.get(is.authorize(loc)).StatusCode).To(Equal(400))
+		Expect(loggedIn()).To(BeFalse())
+
+		// another browser has no state to match.
+		loc = login()
+		callback := is.authorize(loc)
+		s.forget()
+		Expect(s.get(callback).StatusCode).To(Equal(400))
+		Expect(loggedIn()).To(BeFalse())
+	})
+
+	It("reject id tokens for another nonce", func() {
+		is.nonce = "forged"
+		Expect(s.get(is.authorize(login())).StatusCode).To(Equal(401))
+		Expect(loggedIn()).To(BeFalse())
+	})
+
+	It("reject expired id tokens", func() {
+		is.ttl = -time.Minute
+		Expect(s.get(is.authorize(login())).StatusCode).To(Equal(401))
+		Expect(loggedIn()).To(BeFalse())
+	})
+
+	It("not offer single sign-on without the issuer", func() {
+		other := newSite(nil)
+		defer other.close()
+		Expect(other.get("/login/sso").StatusCode).To(Equal(404))
+		Expect(other.get("/login/sso/callback?code=x&state=y").StatusCode).To(Equal(404))
+	})
+})
@@ -0,0 +1,45 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/markdown"
+	"html/template"
+)
+
+// renderMarkdown renders markdown files for render.html, the source is still shown when it fails.
+func renderMarkdown(c *content) {
+	if c.Lang != "Markdown" || c.Binary {
+		return
+	}
+	h, err := markdown.Render([]byte(c.Content))
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	c.Rendered = h
+}
+
+// markdownText renders descriptions, the plain text is escaped when it fails.
+func markdownText(text string) template.HTML {
+	h, err := markdown.Render([]byte(text))
+	if err != nil {
+		log.Debug(err)
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+	return h
+}
@@ -19,11 +19,25 @@ import (
 	"fmt"
 	"github.com/martini-contrib/render"
 	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/org"
 	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/user"
 	"net/http"
 )
 
-func NewEntry(req *http.Request, c config.Config, res render.Render) {
+func NewEntry(req *http.Request, c config.Config, res render.Render, v *Visitor, idx *index.Index) {
+	if requireLogin(req, res, v) == false {
+		return
+	}
+	owner, err := gistOwner(v.User, req.FormValue("owner"), c)
+	if err != nil {
+		log.Debug(err)
+		res.Error(403)
+		return
+	}
+
 	maker := repo.New(c)
 	r, err := maker.MakeRepo()
 
@@ -31,12 +45,30 @@ func NewEntry(req *http.Request, c config.Config, res render.Render) {
 		handleError(res, err)
 		return
 	}
+	if err := idx.Mark(r.Id()); err != nil {
+		handleError(res, err)
+		return
+	}
 
 	if err := r.ApplyDesc(req.FormValue("d")); err != nil {
 		handleError(res, err)
 		return
 	}
 
+	if err := r.ApplyOwner(owner); err != nil {
+		handleError(res, err)
+		return
+	}
+
+	visibility, err := repo.ParseVisibility(req.FormValue("visibility"))
+	if err != nil {
+		visibility = repo.Secret
+	}
+	if err := r.ApplyVisibility(visibility); err != nil {
+		handleError(res, err)
+		return
+	}
+
 	contents := req.Form["c"]
 	clen := len(contents)
 	for index, filename := range req.Form["n"] {
@@ -49,10 +81,25 @@ func NewEntry(req *http.Request, c config.Config, res render.Render) {
 		}
 	}
 
-	// TODO login
-	if err := r.Commit("", ""); err != nil {
+	if err := r.Commit(v.User.Name, v.User.Email); err != nil {
 		handleError(res, err)
 		return
 	}
+	syncIndex(idx, r)
 	res.Redirect(fmt.Sprintf("/%s", r.Id()))
 }
+
+// gistOwner returns the owner of a new gist, which is u or an organization where u is a member.
+func gistOwner(u *user.User, name string, c config.Config) (string, error) {
+	if len(name) < 1 || name == u.Name {
+		return u.Name, nil
+	}
+	o, err := org.New(c).Find(name)
+	if err != nil {
+		return "", err
+	}
+	if o.IsMember(u.Name) == false {
+		return "", fmt.Errorf("%s is not a member of %s", u.Name, name)
+	}
+	return o.Owner(), nil
+}
@@ -0,0 +1,188 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func NewOrgForm(req *http.Request, res render.Render, s sessions.Session, v *Visitor) {
+	if requireLogin(req, res, v) == false {
+		return
+	}
+	res.HTML(200, "neworg", newModel(s, v))
+}
+
+// CreateOrg makes an organization, the visitor becomes its first admin.
+func CreateOrg(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config) {
+	if requireLogin(req, res, v) == false {
+		return
+	}
+	name := req.FormValue("name")
+	model := newModel(s, v)
+	model["name"] = name
+	fail := func(message string) {
+		model["error"] = message
+		res.HTML(400, "neworg", model)
+	}
+	if user.ValidName(name) == false {
+		fail("Name may only contain alphanumeric characters, hyphens and underscores.")
+		return
+	}
+	// gists of users and organizations are told apart by their owners, but their pages and names are not.
+	if _, err := user.New(c).Find(name); err == nil {
+		fail("Name is already taken.")
+		return
+	} else if err != user.UserNotFound {
+		handleError(res, err)
+		return
+	}
+	if err := org.New(c).Create(&org.Org{Name: name, Admins: []string{v.User.Name}}); err == org.OrgExists {
+		fail("Name is already taken.")
+		return
+	} else if err != nil {
+		handleError(res, err)
+		return
+	}
+	res.Redirect(fmt.Sprintf("/org/%s", name))
+}
+
+// OrgPage lists gists of the organization, members see the secret and private ones too.
+func OrgPage(req *http.Request, res render.Render, p martini.Params, s sessions.Session, v *Visitor, c config.Config, idx *index.Index) {
+	o, ok := loadOrg(res, p, c)
+	if ok == false {
+		return
+	}
+	showOrg(req, res, v, c, idx, o, newModel(s, v), 200)
+}
+
+// showOrg renders the page of o, the form of admins keeps the values in model if any.
+func showOrg(req *http.Request, res render.Render, v *Visitor, c config.Config, idx *index.Index, o *org.Org, model map[string]interface{}, status int) {
+	u := reader(v)
+	member := u != nil && o.IsMember(u.Name)
+	gists, err := idx.List(func(g *index.Gist) bool {
+		return g.Owner == o.Owner() && (member || listed(g))
+	})
+	if err != nil {
+		handleError(res, err)
+		return
+	}
+
+	model["org"] = o
+	model["member"] = member
+	if u != nil && o.IsAdmin(u.Name) {
+		model["admin"] = true
+		form := map[string]string{
+			"admins":  strings.Join(o.Admins, "\n"),
+			"members": strings.Join(o.Members, "\n"),
+			"teams":   formatTeams(o.Teams),
+		}
+		for key, value := range form {
+			if _, ok := model[key]; ok == false {
+				model[key] = value
+			}
+		}
+	}
+	shown := u
+	if member == false {
+		shown = nil
+	}
+	if pageModel(req, res, c, shown, model, gists) == false {
+		return
+	}
+	res.HTML(status, "org", model)
+}
+
+// UpdateOrg replaces admins, members and teams, one per line. A team is written as "name: member member".
+// Invalid values are shown on the page again with the reason.
+func UpdateOrg(req *http.Request, res render.Render, p martini.Params, s sessions.Session, v *Visitor, c config.Config, idx *index.Index) {
+	if requireLogin(req, res, v) == false {
+		return
+	}
+	o, ok := loadOrg(res, p, c)
+	if ok == false {
+		return
+	}
+	if o.IsAdmin(v.User.Name) == false {
+		res.Error(403)
+		return
+	}
+	changed := *o
+	changed.Admins = strings.Fields(req.FormValue("admins"))
+	changed.Members = strings.Fields(req.FormValue("members"))
+	teams, err := parseTeams(req.FormValue("teams"))
+	if err == nil {
+		changed.Teams = teams
+		err = org.New(c).Save(&changed)
+	}
+	if err != nil {
+		model := newModel(s, v)
+		model["error"] = err.Error()
+		for _, key := range []string{"admins", "members", "teams"} {
+			model[key] = req.FormValue(key)
+		}
+		showOrg(req, res, v, c, idx, o, model, 400)
+		return
+	}
+	res.Redirect(fmt.Sprintf("/org/%s", o.Name))
+}
+
+func loadOrg(res render.Render, p martini.Params, c config.Config) (*org.Org, bool) {
+	o, err := org.New(c).Find(p["name"])
+	if err != nil {
+		handleNotFound(res, err)
+		return nil, false
+	}
+	return o, true
+}
+
+func parseTeams(s string) (map[string][]string, error) {
+	teams := map[string][]string{}
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); len(line) < 1 {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Unsupported team %s", line)
+		}
+		teams[strings.TrimSpace(kv[0])] = strings.Fields(kv[1])
+	}
+	return teams, nil
+}
+
+func formatTeams(teams map[string][]string) string {
+	names := []string{}
+	for name := range teams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{}
+	for _, name := range names {
+		lines = append(lines, name+": "+strings.Join(teams[name], " "))
+	}
+	return strings.Join(lines, "\n")
+}
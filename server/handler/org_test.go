@@ -0,0 +1,84 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/org"
+	"net/http"
+	"net/url"
+)
+
+var _ = Describe("Organizations", func() {
+	var s *site
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("other")
+		s.signIn("way")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	create := func(name string) (*http.Response, string) {
+		res := s.post("/orgs/new", url.Values{"_csrf": {s.csrf()}, "name": {name}})
+		if res.StatusCode == 302 {
+			res.Body.Close()
+			return res, ""
+		}
+		return res, text(res)
+	}
+
+	It("take only names which nobody has", func() {
+		res, _ := create("acme")
+		Expect(res.StatusCode).To(Equal(302))
+		Expect(res.Header.Get("Location")).To(Equal("/org/acme"))
+
+		for _, name := range []string{"acme", "other"} {
+			res, body := create(name)
+			Expect(res.StatusCode).To(Equal(400), name)
+			Expect(body).To(ContainSubstring("Name is already taken."), name)
+		}
+		_, err := org.New(s.c).Find("other")
+		Expect(err).To(Equal(org.OrgNotFound))
+	})
+
+	It("show what is wrong with the posted members", func() {
+		res, _ := create("acme")
+		Expect(res.StatusCode).To(Equal(302))
+
+		res = s.post("/org/acme", url.Values{"_csrf": {s.csrf()}, "admins": {"way"}, "members": {"bad:name"}, "teams": {""}})
+		Expect(res.StatusCode).To(Equal(400))
+		body := text(res)
+		Expect(body).To(ContainSubstring("Unsupported user name bad:name"))
+		Expect(body).To(ContainSubstring(">bad:name</textarea>"))
+
+		res = s.post("/org/acme", url.Values{"_csrf": {s.csrf()}, "admins": {"way"}, "members": {""}, "teams": {"no colon"}})
+		Expect(res.StatusCode).To(Equal(400))
+		Expect(text(res)).To(ContainSubstring("Unsupported team no colon"))
+
+		o, err := org.New(s.c).Find("acme")
+		Expect(err).To(BeNil())
+		Expect(o.Members).To(BeEmpty())
+
+		res = s.post("/org/acme", url.Values{"_csrf": {s.csrf()}, "admins": {"way"}, "members": {"other"}, "teams": {"ops: other"}})
+		Expect(res.StatusCode).To(Equal(302))
+		o, err = org.New(s.c).Find("acme")
+		Expect(err).To(BeNil())
+		Expect(o.Members).To(Equal([]string{"other"}))
+	})
+})
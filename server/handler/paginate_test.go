@@ -0,0 +1,60 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+)
+
+var _ = Describe("paginate", func() {
+	request := func(query string) *http.Request {
+		req, err := http.NewRequest("GET", "/api/v1/gists?"+query, nil)
+		Expect(err).To(BeNil())
+		return req
+	}
+
+	It("slice pages of the total", func() {
+		p, err := paginate(request(""), 70)
+		Expect(err).To(BeNil())
+		Expect([]int{p.from, p.to}).To(Equal([]int{0, 30}))
+		p, err = paginate(request("page=3"), 70)
+		Expect(err).To(BeNil())
+		Expect([]int{p.from, p.to}).To(Equal([]int{60, 70}))
+		p, err = paginate(request("page=2&per_page=100"), 70)
+		Expect(err).To(BeNil())
+		Expect([]int{p.from, p.to}).To(Equal([]int{70, 70}))
+	})
+
+	It("make huge pages empty", func() {
+		for _, q := range []string{"page=9223372036854775807", "page=307445734561825861&per_page=30", "page=4"} {
+			p, err := paginate(request(q), 70)
+			Expect(err).To(BeNil())
+			Expect([]int{p.from, p.to}).To(Equal([]int{70, 70}))
+		}
+		p, err := paginate(request("page=1"), 0)
+		Expect(err).To(BeNil())
+		Expect([]int{p.from, p.to}).To(Equal([]int{0, 0}))
+	})
+
+	It("reject negative and broken pages", func() {
+		for _, q := range []string{"page=0", "page=-1", "page=-9223372036854775808", "page=x", "page=99999999999999999999", "per_page=0", "per_page=-30", "per_page=101"} {
+			_, err := paginate(request(q), 70)
+			Expect(err).NotTo(BeNil())
+		}
+	})
+})
@@ -0,0 +1,137 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"net/url"
+)
+
+var _ = Describe("Private gists", func() {
+	var (
+		s *site
+		r repo.Repo
+	)
+	BeforeEach(func() {
+		s = newSite(nil)
+		for _, name := range []string{"way", "reader", "writer", "other"} {
+			s.makeUser(name)
+		}
+		member := s.makeUser("member")
+		member.Groups = []string{"cn=dev,ou=groups"}
+		Expect(user.New(s.c).Save(member)).To(BeNil())
+
+		r = s.makeGist("way", repo.Private, "a.txt")
+		Expect(r.ApplyReaders([]string{"user:reader", "team:cn=dev,ou=groups"})).To(BeNil())
+		Expect(r.ApplyWriters([]string{"user:writer"})).To(BeNil())
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	status := func(path string, header http.Header) int {
+		res := s.do("GET", path, nil, header)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	edit := func(form url.Values) *http.Response {
+		form.Set("_csrf", s.csrf())
+		return s.post("/"+r.Id()+"/edit", form)
+	}
+
+	It("open private gists only to the owner and the collaborators", func() {
+		for _, path := range []string{"", "/raw/a.txt", "/archive/HEAD.zip", "/revisions"} {
+			path = "/" + r.Id() + path
+			Expect(status(path, nil)).To(Equal(404))
+			Expect(status(path, basic("other"))).To(Equal(404))
+			for _, name := range []string{"way", "reader", "member", "writer"} {
+				Expect(status(path, basic(name))).To(Equal(200))
+			}
+		}
+		Expect(status("/api/v1/gists/"+r.Id(), basic("other"))).To(Equal(404))
+		Expect(status("/api/v1/gists/"+r.Id(), basic("reader"))).To(Equal(200))
+	})
+
+	It("let only the owner and the writers edit", func() {
+		path := "/" + r.Id() + "/edit"
+		Expect(status(path, nil)).To(Equal(404))
+		Expect(status(path, basic("other"))).To(Equal(404))
+		Expect(status(path, basic("reader"))).To(Equal(403))
+		Expect(status(path, basic("writer"))).To(Equal(200))
+
+		s.signIn("reader")
+		Expect(edit(url.Values{"o": {"a.txt"}, "n": {"a.txt"}, "c": {"by reader"}}).StatusCode).To(Equal(403))
+		s.forget()
+		s.signIn("writer")
+		Expect(edit(url.Values{"o": {"a.txt"}, "n": {"a.txt"}, "c": {"by writer"}}).StatusCode).To(Equal(302))
+		b, err := r.Show(repo.Head, "a.txt")
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("by writer"))
+	})
+
+	It("let only the owner decide the access", func() {
+		s.signIn("writer")
+		res := edit(url.Values{"visibility": {"public"}, "readers": {""}, "writers": {"writer\nother"}})
+		Expect(res.StatusCode).To(Equal(302))
+		v, err := r.Visibility()
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(repo.Private))
+		writers, err := r.Writers()
+		Expect(err).To(BeNil())
+		Expect(writers).To(Equal([]string{"user:writer"}))
+
+		s.forget()
+		s.signIn("way")
+		Expect(edit(url.Values{"visibility": {"hidden"}}).StatusCode).To(Equal(400))
+		res = edit(url.Values{"visibility": {"public"}, "readers": {""}, "writers": {"writer\nother"}})
+		Expect(res.StatusCode).To(Equal(302))
+		v, err = r.Visibility()
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(repo.Public))
+		writers, err = r.Writers()
+		Expect(err).To(BeNil())
+		Expect(writers).To(Equal([]string{"user:writer", "user:other"}))
+	})
+
+	It("let only the owner delete", func() {
+		path := "/api/v1/gists/" + r.Id()
+		Expect(s.do("DELETE", path, nil, basic("other")).StatusCode).To(Equal(404))
+		Expect(s.do("DELETE", path, nil, basic("reader")).StatusCode).To(Equal(403))
+		Expect(s.do("DELETE", path, nil, basic("writer")).StatusCode).To(Equal(403))
+		Expect(s.do("DELETE", path, nil, basic("way")).StatusCode).To(Equal(204))
+	})
+
+	It("ask git clients for credentials", func() {
+		refs := "/" + r.Id() + ".git/info/refs?service="
+		res := s.get(refs + "git-upload-pack")
+		Expect(res.StatusCode).To(Equal(401))
+		Expect(res.Header.Get("WWW-Authenticate")).To(Equal(`Basic realm="gotive"`))
+		Expect(status(refs+"git-upload-pack", basic("other"))).To(Equal(404))
+
+		res = s.do("GET", refs+"git-upload-pack", nil, basic("reader"))
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Content-Type")).To(Equal("application/x-git-upload-pack-advertisement"))
+		Expect(text(res)).To(HavePrefix("001e# service=git-upload-pack\n0000"))
+
+		Expect(status(refs+"git-receive-pack", basic("reader"))).To(Equal(403))
+		Expect(status(refs+"git-receive-pack", basic("writer"))).To(Equal(200))
+		Expect(status(refs+"git-receive-pack", basic("way"))).To(Equal(200))
+	})
+})
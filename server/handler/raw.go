@@ -0,0 +1,102 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/repo"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// RawFile serves a file of the latest tree.
+func RawFile(w http.ResponseWriter, req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	serveRaw(w, req, res, p, v, c, repo.Head)
+}
+
+// RawRevision serves a file as it was at the revision, the response never changes.
+func RawRevision(w http.ResponseWriter, req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	serveRaw(w, req, res, p, v, c, p["sha"])
+}
+
+func serveRaw(w http.ResponseWriter, req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config, rev string) {
+	r, ok := loadReadable(res, p, v, c)
+	if ok == false {
+		return
+	}
+	name := p["_1"]
+
+	// the latest file is read from the HEAD commit too, the working tree may have uncommitted changes.
+	sha, err := r.Resolve(rev)
+	if err != nil {
+		handleNotFound(res, err)
+		return
+	}
+	b, err := r.Show(sha, name)
+	if err != nil {
+		handleNotFound(res, err)
+		return
+	}
+	if err := cacheControl(w.Header(), r, rev != repo.Head); err != nil {
+		handleError(res, err)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", rawContentType(name, b))
+	h.Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", path.Base(name)))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	h.Set("Etag", fmt.Sprintf(`"%x"`, sha1.Sum(b)))
+	// ServeContent answers Range, HEAD and If-* requests.
+	http.ServeContent(w, req, name, time.Time{}, bytes.NewReader(b))
+}
+
+// types which browsers would run as active content on our origin are served as plain text.
+var activeTypes = map[string]bool{
+	"text/html":                true,
+	"application/xhtml+xml":    true,
+	"image/svg+xml":            true,
+	"text/xml":                 true,
+	"application/xml":          true,
+	"text/javascript":          true,
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"text/css":                 true,
+}
+
+func rawContentType(name string, b []byte) string {
+	t := mime.TypeByExtension(path.Ext(name))
+	if len(t) < 1 {
+		t = http.DetectContentType(b)
+	}
+	base := strings.TrimSpace(strings.SplitN(t, ";", 2)[0])
+	if activeTypes[base] {
+		base = "text/plain"
+	}
+	if strings.HasPrefix(base, "text/") {
+		return base + "; charset=utf-8"
+	}
+	return base
+}
@@ -0,0 +1,112 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/repo"
+	"net/http"
+)
+
+var _ = Describe("Raw", func() {
+	var (
+		s *site
+		r repo.Repo
+	)
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("way")
+		s.makeUser("other")
+		r = s.makeGist("way", repo.Public, "hello.txt", "page.html", "dir/nested.go")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	It("serve files with safe headers", func() {
+		res := s.get("/" + r.Id() + "/raw/hello.txt")
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+		Expect(res.Header.Get("X-Content-Type-Options")).To(Equal("nosniff"))
+		Expect(res.Header.Get("Cache-Control")).To(Equal("no-cache"))
+		Expect(text(res)).To(Equal("content of hello.txt"))
+
+		// active content never runs on our origin
+		res = s.get("/" + r.Id() + "/raw/page.html")
+		Expect(res.Header.Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+		Expect(res.Header.Get("Content-Security-Policy")).To(ContainSubstring("sandbox"))
+
+		Expect(text(s.get("/" + r.Id() + "/raw/dir/nested.go"))).To(Equal("content of dir/nested.go"))
+		Expect(s.get("/" + r.Id() + "/raw/missing.txt").StatusCode).To(Equal(404))
+		Expect(s.get("/" + r.Id() + "/raw/.git/config").StatusCode).To(Equal(404))
+	})
+
+	It("answer Range, HEAD and conditional requests", func() {
+		path := "/" + r.Id() + "/raw/hello.txt"
+		res := s.do("GET", path, nil, http.Header{"Range": {"bytes=0-6"}})
+		Expect(res.StatusCode).To(Equal(206))
+		Expect(res.Header.Get("Content-Range")).To(Equal("bytes 0-6/20"))
+		Expect(text(res)).To(Equal("content"))
+
+		res = s.do("GET", path, nil, http.Header{"Range": {"bytes=100-"}})
+		Expect(res.StatusCode).To(Equal(416))
+
+		res = s.do("HEAD", path, nil, nil)
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Content-Length")).To(Equal("20"))
+		Expect(text(res)).To(BeEmpty())
+
+		etag := s.get(path).Header.Get("Etag")
+		Expect(etag).NotTo(BeEmpty())
+		res = s.do("GET", path, nil, http.Header{"If-None-Match": {etag}})
+		Expect(res.StatusCode).To(Equal(304))
+	})
+
+	It("serve committed files only", func() {
+		Expect(r.Update("hello.txt", "not committed")).To(BeNil())
+		Expect(text(s.get("/" + r.Id() + "/raw/hello.txt"))).To(Equal("content of hello.txt"))
+	})
+
+	It("pin files to revisions", func() {
+		revs, err := r.Log()
+		Expect(err).To(BeNil())
+		Expect(r.Update("hello.txt", "changed")).To(BeNil())
+		Expect(r.Commit("way", "way@example.com")).To(BeNil())
+
+		res := s.get("/" + r.Id() + "/" + revs[0].Id + "/raw/hello.txt")
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Cache-Control")).To(Equal("public, max-age=31536000"))
+		Expect(text(res)).To(Equal("content of hello.txt"))
+		Expect(text(s.get("/" + r.Id() + "/raw/hello.txt"))).To(Equal("changed"))
+		Expect(s.get("/" + r.Id() + "/0000000/raw/hello.txt").StatusCode).To(Equal(404))
+	})
+
+	It("hide private files from others", func() {
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		path := "/" + r.Id() + "/raw/hello.txt"
+		Expect(s.get(path).StatusCode).To(Equal(404))
+		Expect(s.do("GET", path, nil, basic("other")).StatusCode).To(Equal(404))
+
+		res := s.do("GET", path, nil, basic("way"))
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Header.Get("Cache-Control")).To(Equal("no-cache"))
+		revs, err := r.Log()
+		Expect(err).To(BeNil())
+		res = s.do("GET", "/"+r.Id()+"/"+revs[0].Id+"/raw/hello.txt", nil, basic("way"))
+		Expect(res.Header.Get("Cache-Control")).To(Equal("private, max-age=31536000"))
+	})
+})
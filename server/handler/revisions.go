@@ -0,0 +1,49 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+)
+
+func Revisions(res render.Render, p martini.Params, s sessions.Session, v *Visitor, c config.Config) {
+	r, ok := loadReadable(res, p, v, c)
+	if ok == false {
+		return
+	}
+
+	model := newModel(s, v)
+	model["id"] = r.Id()
+
+	if desc, err := r.Desc(); err != nil {
+		handleError(res, err)
+		return
+	} else {
+		model["desc"] = desc
+	}
+
+	if revs, err := r.Log(); err != nil {
+		handleError(res, err)
+		return
+	} else {
+		model["revisions"] = revs
+	}
+
+	res.HTML(200, "revisions", model)
+}
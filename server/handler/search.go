@@ -0,0 +1,272 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"bytes"
+	"context"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	// snippetsPerFile bounds the fragments shown for each matched file.
+	snippetsPerFile = 3
+	// grepTimeout bounds the time to read files for a regular expression.
+	grepTimeout = 5 * time.Second
+)
+
+type searchResult struct {
+	Id, Owner, Org string
+	Description    string
+	// DescIndices are the matches in Description.
+	DescIndices [][2]int
+	Score       float64
+	Updated     time.Time
+	Files       []index.FileHit
+}
+
+func (r searchResult) Desc() []index.Segment {
+	return index.Segments(r.Description, r.DescIndices)
+}
+
+type apiTextMatch struct {
+	Filename string   `json:"filename,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Fragment string   `json:"fragment"`
+	Indices  [][2]int `json:"indices"`
+}
+
+type apiSearchResult struct {
+	Id          string         `json:"id"`
+	URL         string         `json:"url"`
+	HtmlURL     string         `json:"html_url"`
+	Description string         `json:"description"`
+	Owner       string         `json:"owner,omitempty"`
+	Org         string         `json:"org,omitempty"`
+	Score       float64        `json:"score"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	TextMatches []apiTextMatch `json:"text_matches"`
+}
+
+// Search finds gists by the words of q, or by the regular expression q when mode is regex.
+// The visitor finds only what it may find in listings or change.
+func Search(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config, idx *index.Index) {
+	model := newModel(s, v)
+	q := req.URL.Query()
+	model["q"] = q.Get("q")
+	model["regex"] = q.Get("mode") == "regex"
+	model["path"] = req.URL.Path
+	if len(q.Get("q")) < 1 {
+		res.HTML(200, "search", model)
+		return
+	}
+	results, pg, complete, err := search(req, c, idx, reader(v))
+	if f, ok := err.(*apiFailure); ok {
+		model["error"] = f.Error()
+		res.HTML(f.status, "search", model)
+		return
+	} else if err != nil {
+		handleError(res, err)
+		return
+	}
+	model["searched"] = true
+	model["results"] = results
+	model["total"] = pg.total
+	model["incomplete"] = complete == false
+	if 1 < pg.number {
+		model["prev"] = pg.number - 1
+	}
+	if pg.to < pg.total {
+		model["next"] = pg.number + 1
+	}
+	res.HTML(200, "search", model)
+}
+
+// SearchGists answers the same as Search, X-Incomplete-Results tells that a regular expression stopped early.
+func SearchGists(req *http.Request, res render.Render, v *Visitor, c config.Config, idx *index.Index) {
+	u, err := apiUser(v, token.Read)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	if len(req.URL.Query().Get("q")) < 1 {
+		handleAPIError(res, failure(422, "q is required"))
+		return
+	}
+	results, pg, complete, err := search(req, c, idx, u)
+	if err != nil {
+		handleAPIError(res, err)
+		return
+	}
+	found := []apiSearchResult{}
+	for _, r := range results {
+		a := apiSearchResult{
+			Id:          r.Id,
+			URL:         absURL(req, "/api/v1/gists/%s", r.Id),
+			HtmlURL:     absURL(req, "/%s", r.Id),
+			Description: r.Description,
+			Owner:       r.Owner,
+			Org:         r.Org,
+			Score:       r.Score,
+			UpdatedAt:   r.Updated,
+			TextMatches: []apiTextMatch{},
+		}
+		if 0 < len(r.DescIndices) {
+			a.TextMatches = append(a.TextMatches, apiTextMatch{Fragment: r.Description, Indices: r.DescIndices})
+		}
+		for _, f := range r.Files {
+			for _, s := range f.Snippets {
+				a.TextMatches = append(a.TextMatches, apiTextMatch{Filename: f.Name, Line: s.Line, Fragment: s.Fragment, Indices: s.Indices})
+			}
+		}
+		found = append(found, a)
+	}
+	pg.header(res.Header())
+	if complete == false {
+		res.Header().Set("X-Incomplete-Results", "true")
+	}
+	res.JSON(200, found)
+}
+
+// search runs the search of the request for u, and returns a page of the results.
+// complete is false when a regular expression stopped before reading every candidate.
+func search(req *http.Request, c config.Config, idx *index.Index, u *user.User) ([]searchResult, page, bool, error) {
+	q := req.URL.Query()
+	if q.Get("mode") == "regex" {
+		return grep(req, c, idx, u)
+	}
+	query := index.ParseQuery(q.Get("q"))
+	found, err := idx.Search(query, searchable(u, c))
+	if err != nil {
+		return nil, page{}, false, err
+	}
+	pg, err := paginate(req, len(found))
+	if err != nil {
+		return nil, page{}, false, err
+	}
+	results := []searchResult{}
+	for _, f := range found[pg.from:pg.to] {
+		results = append(results, toSearchResult(c, query, f))
+	}
+	return results, pg, true, nil
+}
+
+func grep(req *http.Request, c config.Config, idx *index.Index, u *user.User) ([]searchResult, page, bool, error) {
+	re, err := regexp.Compile(req.URL.Query().Get("q"))
+	if err != nil {
+		return nil, page{}, false, failure(422, "%v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grepTimeout)
+	defer cancel()
+	hits, complete, err := idx.Grep(ctx, repo.New(c), re, searchable(u, c))
+	if err != nil {
+		return nil, page{}, false, err
+	}
+	pg, err := paginate(req, len(hits))
+	if err != nil {
+		return nil, page{}, false, err
+	}
+	results := []searchResult{}
+	for _, h := range hits[pg.from:pg.to] {
+		r := newSearchResult(h.Gist)
+		r.Files = h.Files
+		results = append(results, r)
+	}
+	return results, pg, complete, nil
+}
+
+// searchable reports whether u finds g by searching. Beside public gists, u finds gists which
+// u may change and private gists shared with u, but never secret gists of others.
+// The index only narrows the candidates, each one is checked against its repository as it is now
+// before any file is read, so a gist whose access changed after it was indexed never leaks.
+func searchable(u *user.User, c config.Config) func(g *index.Gist) bool {
+	a := acl.New(c)
+	maker := repo.New(c)
+	return func(g *index.Gist) bool {
+		if listed(g) == false && u == nil {
+			return false
+		}
+		r, err := maker.LoadRepo(g.Id)
+		if err != nil {
+			return false
+		}
+		ok, err := findable(a, u, r)
+		if err != nil {
+			log.Debug(err)
+		}
+		return err == nil && ok
+	}
+}
+
+// findable reports whether u finds r by searching, by the current visibility and access of r.
+func findable(a acl.ACL, u *user.User, r repo.Repo) (bool, error) {
+	v, err := r.Visibility()
+	if err != nil || v == repo.Public {
+		return err == nil, err
+	}
+	if ok, err := a.Writable(u, r); err != nil || ok {
+		return ok, err
+	}
+	if v != repo.Private {
+		return false, nil
+	}
+	return a.Readable(u, r)
+}
+
+func newSearchResult(g *index.Gist) searchResult {
+	r := searchResult{Id: g.Id, Owner: g.Owner, Description: g.Description, Updated: g.Updated, Files: []index.FileHit{}}
+	if name, ok := org.ParseOwner(g.Owner); ok {
+		r.Owner, r.Org = "", name
+	}
+	return r
+}
+
+// toSearchResult highlights the description and cuts snippets from the matched files.
+func toSearchResult(c config.Config, q *index.Query, f *index.Result) searchResult {
+	s := newSearchResult(f.Gist)
+	s.Score = f.Score
+	s.DescIndices = q.Highlight(f.Gist.Description)
+	if len(f.Files) < 1 {
+		return s
+	}
+	r, err := repo.New(c).LoadRepo(f.Gist.Id)
+	if err != nil {
+		log.Debug(err)
+		return s
+	}
+	for _, name := range f.Files {
+		m := index.FileHit{Name: name, Snippets: []index.Snippet{}}
+		if b, err := r.Show(repo.Head, name); err != nil {
+			log.Debug(err)
+		} else if bytes.IndexByte(b, 0) < 0 {
+			m.Snippets = q.Snippets(string(b), snippetsPerFile)
+		}
+		s.Files = append(s.Files, m)
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/server/org"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/user"
+	"sort"
+)
+
+var _ = Describe("Search", func() {
+	var s *site
+	BeforeEach(func() {
+		s = newSite(nil)
+		s.makeUser("way")
+		s.makeUser("other")
+	})
+	AfterEach(func() {
+		s.close()
+	})
+
+	found := func(mode string, name string) []string {
+		res := s.do("GET", "/api/v1/search?mode="+mode+"&q=content", nil, basic(name))
+		Expect(res.StatusCode).To(Equal(200))
+		results := []struct {
+			Id string `json:"id"`
+		}{}
+		decode(res, &results)
+		ids := []string{}
+		for _, r := range results {
+			ids = append(ids, r.Id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	ids := func(rs ...repo.Repo) []string {
+		ids := []string{}
+		for _, r := range rs {
+			ids = append(ids, r.Id())
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	It("find gists which the user may see", func() {
+		Expect(org.New(s.c).Save(&org.Org{Name: "acme", Admins: []string{"other"}, Members: []string{"way"}})).To(BeNil())
+
+		public := s.makeGist("other", repo.Public, "a.txt")
+		secret := s.makeGist("way", repo.Secret, "a.txt")
+		private := s.makeGist("way", repo.Private, "a.txt")
+		owned := s.makeGist("org:acme", repo.Private, "a.txt")
+		writable := s.makeGist("other", repo.Secret, "a.txt")
+		Expect(writable.ApplyWriters([]string{"user:way"})).To(BeNil())
+		readable := s.makeGist("other", repo.Private, "a.txt")
+		Expect(readable.ApplyReaders([]string{"user:way"})).To(BeNil())
+		// readers see private gists only, secret ones stay unlisted.
+		shared := s.makeGist("other", repo.Secret, "a.txt")
+		Expect(shared.ApplyReaders([]string{"user:way"})).To(BeNil())
+		s.makeGist("other", repo.Private, "a.txt")
+		s.makeGist("", repo.Secret, "a.txt")
+
+		for _, mode := range []string{"", "regex"} {
+			Expect(found(mode, "way")).To(Equal(ids(public, secret, private, owned, writable, readable)))
+		}
+
+		u, err := user.New(s.c).Find("way")
+		Expect(err).To(BeNil())
+		u.Roles = []string{user.AdminRole}
+		Expect(user.New(s.c).Save(u)).To(BeNil())
+		Expect(found("", "way")).To(HaveLen(7))
+	})
+
+	It("recheck gists whose access changed after they were indexed", func() {
+		r := s.makeGist("other", repo.Public, "a.txt")
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		for _, mode := range []string{"", "regex"} {
+			Expect(found(mode, "way")).To(BeEmpty())
+			Expect(found(mode, "other")).To(Equal([]string{r.Id()}))
+			res := s.get("/api/v1/search?mode=" + mode + "&q=content")
+			Expect(text(res)).NotTo(ContainSubstring("content of"))
+		}
+	})
+})
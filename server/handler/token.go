@@ -0,0 +1,92 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package handler
+
+import (
+	"github.com/codegangsta/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// requireAccount allows only the login session or the password, so a token can not mint broader tokens.
+func requireAccount(req *http.Request, res render.Render, v *Visitor) bool {
+	if requireLogin(req, res, v) == false {
+		return false
+	}
+	if v.Token != nil {
+		res.Error(403)
+		return false
+	}
+	return true
+}
+
+func Tokens(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config) {
+	if requireAccount(req, res, v) == false {
+		return
+	}
+	renderTokens(200, res, newModel(s, v), v, c)
+}
+
+func MintToken(req *http.Request, res render.Render, s sessions.Session, v *Visitor, c config.Config) {
+	if requireAccount(req, res, v) == false {
+		return
+	}
+	model := newModel(s, v)
+	var expires time.Time
+	if days, err := strconv.Atoi(req.FormValue("expires")); err == nil && 0 < days {
+		expires = time.Now().AddDate(0, 0, days)
+	}
+	secret, t, err := token.New(c).Mint(v.User, req.FormValue("note"), req.Form["scope"], expires)
+	if err != nil {
+		model["error"] = err.Error()
+		renderTokens(400, res, model, v, c)
+		return
+	}
+	model["secret"], model["minted"] = secret, t
+	renderTokens(200, res, model, v, c)
+}
+
+func RevokeToken(req *http.Request, res render.Render, p martini.Params, v *Visitor, c config.Config) {
+	if requireAccount(req, res, v) == false {
+		return
+	}
+	if err := token.New(c).Revoke(v.User.Name, p["token"]); err == token.TokenNotFound {
+		handleNotFound(res, err)
+		return
+	} else if err != nil {
+		handleError(res, err)
+		return
+	}
+	res.Redirect("/settings/tokens")
+}
+
+func renderTokens(status int, res render.Render, model map[string]interface{}, v *Visitor, c config.Config) {
+	tokens, err := token.New(c).List(v.User.Name)
+	if err != nil {
+		handleError(res, err)
+		return
+	}
+	model["tokens"] = tokens
+	model["scopes"] = token.Scopes
+	model["admin"] = v.User.HasRole(user.AdminRole)
+	res.HTML(status, "tokens", model)
+}
@@ -24,3 +24,8 @@ func handleError(res render.Render, err error) {
 	log.Error(err)
 	res.Error(500)
 }
+
+func handleNotFound(res render.Render, err error) {
+	log.Debug(err)
+	res.Error(404)
+}
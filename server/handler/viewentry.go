@@ -18,24 +18,41 @@ package handler
 import (
 	"github.com/codegangsta/martini"
 	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
 	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/lang"
 	"github.com/taichi/gotive/server/repo"
-	"os"
+	"html/template"
 )
 
 type content struct {
 	Name, Content string
+	Lang          string
+	Binary        bool
+	// Anchor prefixes the ids of the lines in HTML.
+	Anchor string
+	HTML   template.HTML
+	// Rendered is the document of markdown files and notebooks.
+	Rendered template.HTML
 }
 
-func ViewEntry(res render.Render, p martini.Params, c config.Config) {
-	maker := repo.New(c)
-	r, err := maker.LoadRepo(p["id"])
-	if err != nil {
-		handleError(res, err)
+func ViewEntry(res render.Render, p martini.Params, s sessions.Session, v *Visitor, c config.Config, idx *index.Index) {
+	viewRevision(res, p, v, newModel(s, v), repo.Head, c, idx)
+}
+
+func ViewRevision(res render.Render, p martini.Params, s sessions.Session, v *Visitor, c config.Config, idx *index.Index) {
+	viewRevision(res, p, v, newModel(s, v), p["sha"], c, idx)
+}
+
+func viewRevision(res render.Render, p martini.Params, v *Visitor, model map[string]interface{}, rev string, c config.Config, idx *index.Index) {
+	r, ok := loadReadable(res, p, v, c)
+	if ok == false {
 		return
 	}
 
-	model := map[string]interface{}{}
+	model["id"] = r.Id()
 
 	if desc, err := r.Desc(); err != nil {
 		handleError(res, err)
@@ -44,20 +61,69 @@ func ViewEntry(res render.Render, p martini.Params, c config.Config) {
 		model["desc"] = desc
 	}
 
-	contents := []content{}
-	walkRepo := func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() == false {
-			if c, err := r.ReadFile(path); err == nil {
-				contents = append(contents, content{Name: path, Content: string(c)})
-			}
+	if rev != repo.Head {
+		sha, err := r.Resolve(rev)
+		if err != nil {
+			handleNotFound(res, err)
+			return
+		}
+		rev = sha
+		model["rev"] = sha
+	} else if sha, err := r.Resolve(rev); err == nil {
+		model["head"] = sha
+	}
+
+	// the parent is shown only to visitors who may read it
+	if parent, err := r.Parent(); err != nil {
+		handleError(res, err)
+		return
+	} else if _, err := acl.New(c).Load(reader(v), parent); err == nil {
+		model["parent"] = parent
+	}
+
+	if visibility, err := r.Visibility(); err != nil {
+		handleError(res, err)
+		return
+	} else {
+		model["visibility"] = string(visibility)
+	}
+
+	if forks, err := idx.Forks(r.Id(), listed); err != nil {
+		handleError(res, err)
+		return
+	} else {
+		ids := []string{}
+		for _, f := range forks {
+			ids = append(ids, f.Id)
 		}
-		return nil
+		model["forks"] = ids
 	}
-	if err := r.Walk(walkRepo); err != nil {
+
+	if contents, err := readContents(r, rev); err != nil {
 		handleError(res, err)
 		return
+	} else {
+		for i := range contents {
+			highlightContent(&contents[i])
+			renderMarkdown(&contents[i])
+			renderNotebook(&contents[i])
+		}
+		model["contents"] = contents
 	}
-	model["contents"] = contents
 
 	res.HTML(200, "render", model)
 }
+
+func readContents(r repo.Repo, rev string) ([]content, error) {
+	contents := []content{}
+	files, err := r.Files(rev)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if c, err := r.Show(rev, path); err == nil {
+			contents = append(contents, content{Name: path, Content: string(c), Lang: lang.Detect(path, c)})
+		}
+	}
+	return contents, nil
+}
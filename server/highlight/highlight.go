@@ -0,0 +1,125 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package highlight
+
+import (
+	"bytes"
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// lexerNames maps languages of the lang package to chroma lexers, where their names differ.
+var lexerNames = map[string]string{
+	"Vim script":       "vim",
+	"Jupyter Notebook": "json",
+}
+
+var style = styles.Get("github")
+
+func lexer(lang string) chroma.Lexer {
+	if name, ok := lexerNames[lang]; ok {
+		lang = name
+	}
+	l := lexers.Get(lang)
+	if l == nil {
+		l = lexers.Fallback
+	}
+	return chroma.Coalesce(l)
+}
+
+// Code renders content as lang, every line is numbered and has the anchor prefix followed by its number.
+func Code(lang, content, prefix string) (template.HTML, error) {
+	it, err := lexer(lang).Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+	f := html.New(html.WithClasses(true), html.TabWidth(4), html.WithLineNumbers(true), html.WithLinkableLineNumbers(true, prefix))
+	var b bytes.Buffer
+	if err := f.Format(&b, style, it); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// Block renders content as lang without numbers, for code embedded in documents.
+func Block(lang, content string) (template.HTML, error) {
+	it, err := lexer(lang).Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+	f := html.New(html.WithClasses(true), html.TabWidth(4))
+	var b bytes.Buffer
+	if err := f.Format(&b, style, it); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// Lines renders content as lang without numbers and splits it into lines, for diffs.
+// The whole content is highlighted at once, so constructs spanning lines keep their colors.
+func Lines(lang, content string) ([]template.HTML, error) {
+	it, err := lexer(lang).Tokenise(nil, content)
+	if err != nil {
+		return nil, err
+	}
+	f := html.New(html.WithClasses(true), html.TabWidth(4), html.PreventSurroundingPre(true))
+	lines := []template.HTML{}
+	for _, tokens := range chroma.SplitTokensIntoLines(it.Tokens()) {
+		last := &tokens[len(tokens)-1]
+		last.Value = strings.TrimSuffix(last.Value, "\n")
+		var b bytes.Buffer
+		if err := f.Format(&b, style, chroma.Literator(tokens...)); err != nil {
+			return nil, err
+		}
+		lines = append(lines, template.HTML(b.String()))
+	}
+	return lines, nil
+}
+
+// CSS returns the stylesheet of the classes which Code and Lines write.
+func CSS() ([]byte, error) {
+	var b bytes.Buffer
+	if err := html.New(html.WithClasses(true)).WriteCSS(&b, style); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Classes matches class attributes which hold only classes of the stylesheet, like the ones Block writes.
+var Classes = classes()
+
+func classes() *regexp.Regexp {
+	names := []string{}
+	for _, c := range chroma.StandardTypes {
+		if 0 < len(c) {
+			names = append(names, regexp.QuoteMeta(c))
+		}
+	}
+	class := "(" + strings.Join(names, "|") + ")"
+	return regexp.MustCompile("^" + class + "( " + class + ")*$")
+}
+
+var nonAnchor = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Anchor returns the prefix of line anchors in a file, "src/main.go" has "src-main-go-L".
+func Anchor(name string) string {
+	return strings.Trim(nonAnchor.ReplaceAllString(strings.ToLower(name), "-"), "-") + "-L"
+}
@@ -0,0 +1,70 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package highlight_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taichi/gotive/server/highlight"
+)
+
+var _ = Describe("Highlight", func() {
+	It("number lines with anchors", func() {
+		h, err := Code("Go", "package main\n\nfunc main() {}\n", "main-go-L")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(h)).To(ContainSubstring(`id="main-go-L1"`))
+		Expect(string(h)).To(ContainSubstring(`href="#main-go-L3"`))
+		Expect(string(h)).NotTo(ContainSubstring(`id="main-go-L4"`))
+		Expect(string(h)).To(ContainSubstring(`<span class="kd">func</span>`))
+	})
+
+	It("escape the content", func() {
+		h, err := Code("Text", "<script>alert(1)</script>", "a-L")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(h)).NotTo(ContainSubstring("<script>"))
+		Expect(string(h)).To(ContainSubstring("&lt;script&gt;"))
+
+		h, err = Code("Unknown Language", "x < y", "a-L")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(h)).To(ContainSubstring("x &lt; y"))
+	})
+
+	It("highlight lines without numbers", func() {
+		lines, err := Lines("Python", "def f(a):\n    return \"\"\"a\nb\"\"\"\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lines).To(HaveLen(3))
+		Expect(string(lines[0])).To(HavePrefix("<span"))
+		for _, l := range lines {
+			Expect(string(l)).NotTo(ContainSubstring("<pre"))
+			Expect(string(l)).NotTo(ContainSubstring("lnlinks"))
+			Expect(string(l)).NotTo(ContainSubstring("\n"))
+		}
+		// the string opened on the line before keeps its color
+		Expect(string(lines[2])).To(ContainSubstring(`<span class="s`))
+	})
+
+	It("write the stylesheet", func() {
+		css, err := CSS()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(css)).To(ContainSubstring(".chroma"))
+	})
+
+	It("make anchors of file names", func() {
+		Expect(Anchor("src/main.go")).To(Equal("src-main-go-L"))
+		Expect(Anchor("README.md")).To(Equal("readme-md-L"))
+		Expect(Anchor("日本語.txt")).To(Equal("txt-L"))
+	})
+})
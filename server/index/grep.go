@@ -0,0 +1,250 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/repo"
+	bolt "go.etcd.io/bbolt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// trigrams returns the distinct three byte sequences of the lower cased text.
+func trigrams(text string) map[string]bool {
+	grams := map[string]bool{}
+	b := strings.ToLower(text)
+	for i := 0; i+3 <= len(b); i++ {
+		grams[b[i:i+3]] = true
+	}
+	return grams
+}
+
+func gramKey(gram, id string) []byte {
+	return []byte(gram + id)
+}
+
+// putGrams indexes the trigrams of the file contents in doc, so Grep reads only files which may match.
+func putGrams(tx *bolt.Tx, id string, doc document) error {
+	files := map[string][]string{}
+	for field, text := range doc {
+		if strings.HasPrefix(field, contentField) == false {
+			continue
+		}
+		name := field[len(contentField):]
+		for gram := range trigrams(text) {
+			files[gram] = append(files[gram], name)
+		}
+	}
+	b := tx.Bucket(gramsBucket)
+	grams := []string{}
+	for gram, names := range files {
+		v, err := json.Marshal(names)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(gramKey(gram, id), v); err != nil {
+			return err
+		}
+		grams = append(grams, gram)
+	}
+	v, err := json.Marshal(grams)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(gramsOfBucket).Put([]byte(id), v)
+}
+
+func removeGrams(tx *bolt.Tx, id string) error {
+	v := tx.Bucket(gramsOfBucket).Get([]byte(id))
+	if v == nil {
+		return nil
+	}
+	grams := []string{}
+	if err := json.Unmarshal(v, &grams); err != nil {
+		return err
+	}
+	b := tx.Bucket(gramsBucket)
+	for _, gram := range grams {
+		if err := b.Delete(gramKey(gram, id)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(gramsOfBucket).Delete([]byte(id))
+}
+
+// literals returns strings which every match of re contains, ignoring the case.
+func literals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return literals(re.Sub[0])
+	case syntax.OpRepeat:
+		if 0 < re.Min {
+			return literals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		found := []string{}
+		for _, sub := range re.Sub {
+			found = append(found, literals(sub)...)
+		}
+		return found
+	}
+	// alternations and classes may match anything as far as trigrams tell.
+	return nil
+}
+
+// candidates returns the files which contain every trigram of the literals, by gist id.
+// A nil map means that trigrams tell nothing, and every file is a candidate.
+func candidates(tx *bolt.Tx, lits []string) (map[string]map[string]bool, error) {
+	var found map[string]map[string]bool
+	for _, lit := range lits {
+		for gram := range trigrams(lit) {
+			files := map[string]map[string]bool{}
+			prefix := []byte(gram)
+			c := tx.Bucket(gramsBucket).Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				id := string(k[len(prefix):])
+				if found != nil && found[id] == nil {
+					continue
+				}
+				names := []string{}
+				if err := json.Unmarshal(v, &names); err != nil {
+					return nil, err
+				}
+				for _, name := range names {
+					if found == nil || found[id][name] {
+						if files[id] == nil {
+							files[id] = map[string]bool{}
+						}
+						files[id][name] = true
+					}
+				}
+			}
+			found = files
+		}
+	}
+	return found, nil
+}
+
+// FileHit is a file with the snippets around its matched lines.
+type FileHit struct {
+	Name     string
+	Snippets []Snippet
+}
+
+// Hit is a gist found by Grep.
+type Hit struct {
+	Gist  *Gist
+	Files []FileHit
+}
+
+const (
+	// grepContext is the lines shown around matched lines.
+	grepContext = 2
+	// maxHits bounds the gists which Grep returns.
+	maxHits = 100
+	// hitsPerFile bounds the snippets of a file.
+	hitsPerFile = 5
+)
+
+// Grep finds the lines of files which match re, in gists passing filter, the most recently updated first.
+// The trigram index narrows the files to read, and ctx bounds the time to read them.
+// complete is false when ctx is done or maxHits are found before every candidate is read.
+func (x *Index) Grep(ctx context.Context, maker repo.RepoMaker, re *regexp.Regexp, filter func(g *Gist) bool) (hits []*Hit, complete bool, err error) {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil, false, err
+	}
+	lits := literals(parsed.Simplify())
+
+	var files map[string]map[string]bool
+	gists := []*Gist{}
+	err = x.db.View(func(tx *bolt.Tx) error {
+		var err error
+		if files, err = candidates(tx, lits); err != nil {
+			return err
+		}
+		c := tx.Bucket(updatedBucket).Cursor()
+		for k, id := c.Last(); k != nil; k, id = c.Prev() {
+			if files != nil && files[string(id)] == nil {
+				continue
+			}
+			g, err := get(tx, string(id))
+			if err != nil {
+				return err
+			}
+			gists = append(gists, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	match := func(line string) [][2]int {
+		indices := [][2]int{}
+		for _, ix := range re.FindAllStringIndex(line, -1) {
+			if ix[0] < ix[1] {
+				indices = append(indices, [2]int{ix[0], ix[1]})
+			}
+		}
+		return indices
+	}
+	hits = []*Hit{}
+	for _, g := range gists {
+		if ctx.Err() != nil || len(hits) == maxHits {
+			return hits, false, nil
+		}
+		if filter(g) == false {
+			continue
+		}
+		r, err := maker.LoadRepo(g.Id)
+		if err != nil {
+			log.Debug(err)
+			continue
+		}
+		hit := &Hit{Gist: g, Files: []FileHit{}}
+		for _, f := range g.Files {
+			if files != nil && files[g.Id][f.Name] == false {
+				continue
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			b, err := r.Show(repo.Head, f.Name)
+			if err != nil {
+				log.Debug(err)
+				continue
+			}
+			if maxContent < len(b) || bytes.IndexByte(b, 0) != -1 {
+				continue
+			}
+			if snippets := cut(string(b), match, grepContext, hitsPerFile); 0 < len(snippets) {
+				hit.Files = append(hit.Files, FileHit{Name: f.Name, Snippets: snippets})
+			}
+		}
+		if 0 < len(hit.Files) {
+			hits = append(hits, hit)
+		}
+	}
+	return hits, ctx.Err() == nil, nil
+}
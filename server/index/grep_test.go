@@ -0,0 +1,120 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package index_test
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var _ = Describe("Grep", func() {
+	var (
+		maker repo.RepoMaker
+		idx   *Index
+		root  string
+	)
+	BeforeEach(func() {
+		c := config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "grep")
+		Expect(err).To(BeNil())
+		root = p
+		c.Repo = filepath.Join(p, "repo")
+		c.Index = filepath.Join(p, "index.db")
+		maker = repo.New(c)
+		idx, err = Open(c)
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		Expect(idx.Close()).To(BeNil())
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	makeGist := func(owner string, files map[string]string) repo.Repo {
+		r, err := maker.MakeRepo()
+		Expect(err).To(BeNil())
+		Expect(r.ApplyOwner(owner)).To(BeNil())
+		for name, content := range files {
+			Expect(r.Add(name, content)).To(BeNil())
+		}
+		Expect(r.Commit(owner, owner+"@example.com")).To(BeNil())
+		Expect(idx.Sync(r)).To(BeNil())
+		return r
+	}
+	all := func(g *Gist) bool { return true }
+	grep := func(pattern string) []*Hit {
+		hits, complete, err := idx.Grep(context.Background(), maker, regexp.MustCompile(pattern), all)
+		Expect(err).To(BeNil())
+		Expect(complete).To(BeTrue())
+		return hits
+	}
+
+	It("find lines with numbers and context", func() {
+		r := makeGist("alice", map[string]string{
+			"main.go":  "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n",
+			"notes.md": "no code here\n",
+		})
+		makeGist("bob", map[string]string{"other.txt": "Println is not called\n"})
+
+		hits := grep(`fmt\.Print(ln|f)\(`)
+		Expect(hits).To(HaveLen(1))
+		Expect(hits[0].Gist.Id).To(Equal(r.Id()))
+		Expect(hits[0].Files).To(Equal([]FileHit{{Name: "main.go", Snippets: []Snippet{{
+			Line:     4,
+			Fragment: "\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n",
+			Indices:  [][2]int{{16, 28}},
+		}}}}))
+		lines := hits[0].Files[0].Snippets[0].Lines()
+		Expect(lines).To(HaveLen(5))
+		Expect(lines[2].Number).To(Equal(6))
+		Expect(lines[2].Segments).To(Equal([]Segment{{"\t", false}, {"fmt.Println(", true}, {"\"hello\")", false}}))
+
+		Expect(grep(`(?i)PRINTLN`)).To(HaveLen(2))
+		Expect(grep(`p.ckage|no code`)).To(HaveLen(1))
+		Expect(grep(`nothing here`)).To(BeEmpty())
+	})
+
+	It("follow changes and filters", func() {
+		r := makeGist("alice", map[string]string{"a.txt": "old text\n"})
+		Expect(grep("old")).To(HaveLen(1))
+		Expect(r.Update("a.txt", "new text\n")).To(BeNil())
+		Expect(r.Commit("alice", "alice@example.com")).To(BeNil())
+		Expect(idx.Sync(r)).To(BeNil())
+		Expect(grep("old")).To(BeEmpty())
+
+		hits, _, err := idx.Grep(context.Background(), maker, regexp.MustCompile("new"), func(g *Gist) bool { return false })
+		Expect(err).To(BeNil())
+		Expect(hits).To(BeEmpty())
+	})
+
+	It("stop when the time is up", func() {
+		makeGist("alice", map[string]string{"a.txt": "text\n"})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		hits, complete, err := idx.Grep(ctx, maker, regexp.MustCompile("text"), all)
+		Expect(err).To(BeNil())
+		Expect(complete).To(BeFalse())
+		Expect(hits).To(BeEmpty())
+	})
+})
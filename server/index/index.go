@@ -0,0 +1,515 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/lang"
+	"github.com/taichi/gotive/server/repo"
+	bolt "go.etcd.io/bbolt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Gist is what listings need to know about a gist, without touching its repository.
+// Files are the ones of the commit Revision.
+type Gist struct {
+	Id          string          `json:"id"`
+	Owner       string          `json:"owner"`
+	Visibility  repo.Visibility `json:"visibility"`
+	Description string          `json:"description"`
+	Parent      string          `json:"parent,omitempty"`
+	Revision    string          `json:"revision,omitempty"`
+	Files       []File          `json:"files"`
+	Created     time.Time       `json:"created"`
+	Updated     time.Time       `json:"updated"`
+}
+
+type File struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Type     string `json:"type"`
+	Size     int    `json:"size"`
+}
+
+// ContentType sniffs the media type of content, without parameters.
+func ContentType(content []byte) string {
+	t := http.DetectContentType(content)
+	if i := strings.Index(t, ";"); 0 < i {
+		t = t[:i]
+	}
+	return t
+}
+
+// Languages returns the distinct languages of the files, in the order of the files.
+func (g *Gist) Languages() []string {
+	seen := map[string]bool{}
+	langs := []string{}
+	for _, f := range g.Files {
+		if seen[f.Language] == false {
+			seen[f.Language] = true
+			langs = append(langs, f.Language)
+		}
+	}
+	return langs
+}
+
+var GistNotFound = fmt.Errorf("Gist not found")
+
+var (
+	gistsBucket    = []byte("gists")
+	updatedBucket  = []byte("updated")
+	postingsBucket = []byte("postings")
+	termsBucket    = []byte("terms")
+	gramsBucket    = []byte("grams")
+	gramsOfBucket  = []byte("gramsof")
+	metaBucket     = []byte("meta")
+	dirtyBucket    = []byte("dirty")
+	cursorKey      = []byte("reindex")
+	versionKey     = []byte("version")
+)
+
+// version changes when the layout of the index does, and the index is rebuilt then.
+var version = []byte("5")
+
+// Index keeps the metadata of every gist in a bolt database, so listings need not scan c.Repo,
+// an inverted index of their words for Search, and the trigrams of their files for Grep.
+// It is derived from the repositories and rebuilt by Reindex whenever in doubt.
+type Index struct {
+	db     *bolt.DB
+	maker  repo.RepoMaker
+	opened time.Time
+}
+
+// Open opens the index at c.Index, it fails while another process holds the index.
+func Open(c config.Config) (*Index, error) {
+	db, err := bolt.Open(c.Index, 0600, &bolt.Options{Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("Index %s is used by another process", c.Index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{gistsBucket, updatedBucket, postingsBucket, termsBucket, gramsBucket, gramsOfBucket, metaBucket, dirtyBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Index{db: db, maker: repo.New(c), opened: time.Now()}, nil
+}
+
+func (x *Index) Close() error {
+	return x.db.Close()
+}
+
+// collect reads the metadata and the searchable text of r from its repository.
+// Each file is read once, for its language and for its words.
+func collect(r repo.Repo) (*Gist, document, error) {
+	g := &Gist{Id: r.Id(), Files: []File{}}
+	var err error
+	if g.Owner, err = r.Owner(); err != nil {
+		return nil, nil, err
+	}
+	if g.Visibility, err = r.Visibility(); err != nil {
+		return nil, nil, err
+	}
+	if g.Description, err = r.Desc(); err != nil {
+		return nil, nil, err
+	}
+	if g.Parent, err = r.Parent(); err != nil {
+		return nil, nil, err
+	}
+	files, err := r.Files(repo.Head)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := document{descriptionField: g.Description}
+	for _, name := range files {
+		b, err := r.Show(repo.Head, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		g.Files = append(g.Files, File{Name: name, Language: lang.Detect(name, b), Type: ContentType(b), Size: len(b)})
+		doc.add(name, b)
+	}
+	revs, err := r.Log()
+	if err != nil {
+		return nil, nil, err
+	}
+	if 0 < len(revs) {
+		g.Revision = revs[0].Id
+		g.Updated = revs[0].Date
+		g.Created = revs[len(revs)-1].Date
+	}
+	return g, doc, nil
+}
+
+// Sync stores the current metadata and words of r, call it after every change of the repository.
+// A gist which fails is marked dirty, and synced again after the next successful sync.
+func (x *Index) Sync(r repo.Repo) error {
+	if err := x.sync(r); err != nil {
+		x.dirty(r.Id())
+		return err
+	}
+	x.retry()
+	return nil
+}
+
+// sync reads r outside of transactions, so writers of the index never wait for git.
+// r is stored only if it was not marked again while it was read, the sync of that
+// later change stores the later state then.
+func (x *Index) sync(r repo.Repo) error {
+	id := []byte(r.Id())
+	var mark []byte
+	err := x.db.View(func(tx *bolt.Tx) error {
+		mark = append(mark, tx.Bucket(dirtyBucket).Get(id)...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	g, doc, err := collect(r)
+	if err != nil {
+		return err
+	}
+	return x.db.Update(func(tx *bolt.Tx) error {
+		dirty := tx.Bucket(dirtyBucket)
+		if bytes.Equal(dirty.Get(id), mark) == false {
+			return nil
+		}
+		if err := put(tx, g, doc); err != nil {
+			return err
+		}
+		return dirty.Delete(id)
+	})
+}
+
+// Mark marks id dirty before its repository changes, so a change which never reaches Sync,
+// because the process stopped in between, is synced again after a later sync.
+func (x *Index) Mark(id string) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		return mark(tx, id, time.Now())
+	})
+}
+
+// pending is how long a mark waits for the Sync of its change, before other syncs retry it.
+const pending = time.Minute
+
+// mark puts a new sequence number for id, so every mark differs from the ones before,
+// followed by the time of the change. Failed syncs have no time, they are retried at once.
+func mark(tx *bolt.Tx, id string, at time.Time) error {
+	b := tx.Bucket(dirtyBucket)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	v := make([]byte, 16)
+	binary.BigEndian.PutUint64(v, seq)
+	if at.IsZero() == false {
+		binary.BigEndian.PutUint64(v[8:], uint64(at.UnixNano()))
+	}
+	return b.Put([]byte(id), v)
+}
+
+// dirty marks id to be synced again, the index may stay stale until then.
+func (x *Index) dirty(id string) {
+	err := x.db.Update(func(tx *bolt.Tx) error {
+		return mark(tx, id, time.Time{})
+	})
+	if err != nil {
+		log.Errorf("fail to mark %s dirty: %v", id, err)
+	}
+}
+
+// retry syncs the dirty gists again, the gists whose repositories are gone are removed.
+// Changes in progress are left to their own Sync, unless they were marked before the index
+// was opened or long ago, then the process making them has stopped.
+func (x *Index) retry() {
+	ids := []string{}
+	err := x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(dirtyBucket).ForEach(func(k, v []byte) error {
+			if len(v) == 16 {
+				at := time.Unix(0, int64(binary.BigEndian.Uint64(v[8:])))
+				if x.opened.Before(at) && time.Since(at) < pending {
+					return nil
+				}
+			}
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		log.Errorf("fail to read dirty gists: %v", err)
+		return
+	}
+	for _, id := range ids {
+		r, err := x.maker.LoadRepo(id)
+		if err != nil {
+			log.Debugf("remove dirty %s: %v", id, err)
+			err = x.db.Update(func(tx *bolt.Tx) error {
+				if err := remove(tx, id); err != nil {
+					return err
+				}
+				return tx.Bucket(dirtyBucket).Delete([]byte(id))
+			})
+		} else {
+			err = x.sync(r)
+		}
+		if err != nil {
+			log.Warnf("fail to sync dirty %s: %v", id, err)
+		}
+	}
+}
+
+// Dirty returns the ids of the gists which wait for another sync.
+func (x *Index) Dirty() ([]string, error) {
+	ids := []string{}
+	err := x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(dirtyBucket).ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	return ids, err
+}
+
+func put(tx *bolt.Tx, g *Gist, doc document) error {
+	if err := remove(tx, g.Id); err != nil {
+		return err
+	}
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(gistsBucket).Put([]byte(g.Id), b); err != nil {
+		return err
+	}
+	if err := tx.Bucket(updatedBucket).Put(updatedKey(g), []byte(g.Id)); err != nil {
+		return err
+	}
+	if err := putPostings(tx, g.Id, doc); err != nil {
+		return err
+	}
+	return putGrams(tx, g.Id, doc)
+}
+
+// updatedKey sorts gists by the time of their last commit, then by id.
+func updatedKey(g *Gist) []byte {
+	k := make([]byte, 8, 8+len(g.Id))
+	if g.Updated.IsZero() == false {
+		binary.BigEndian.PutUint64(k, uint64(g.Updated.Unix()))
+	}
+	return append(k, g.Id...)
+}
+
+// Remove forgets the gist id, forgetting an unknown gist is not an error.
+// A gist which fails is marked dirty like Sync does.
+func (x *Index) Remove(id string) error {
+	err := x.db.Update(func(tx *bolt.Tx) error {
+		if err := remove(tx, id); err != nil {
+			return err
+		}
+		return tx.Bucket(dirtyBucket).Delete([]byte(id))
+	})
+	if err != nil {
+		x.dirty(id)
+	}
+	return err
+}
+
+func remove(tx *bolt.Tx, id string) error {
+	if err := removePostings(tx, id); err != nil {
+		return err
+	}
+	if err := removeGrams(tx, id); err != nil {
+		return err
+	}
+	old, err := get(tx, id)
+	if err == GistNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(updatedBucket).Delete(updatedKey(old)); err != nil {
+		return err
+	}
+	return tx.Bucket(gistsBucket).Delete([]byte(id))
+}
+
+func (x *Index) Get(id string) (*Gist, error) {
+	var g *Gist
+	err := x.db.View(func(tx *bolt.Tx) error {
+		var err error
+		g, err = get(tx, id)
+		return err
+	})
+	return g, err
+}
+
+func get(tx *bolt.Tx, id string) (*Gist, error) {
+	b := tx.Bucket(gistsBucket).Get([]byte(id))
+	if b == nil {
+		return nil, GistNotFound
+	}
+	g := &Gist{}
+	if err := json.Unmarshal(b, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// List returns every gist which passes filter, the most recently updated first.
+func (x *Index) List(filter func(g *Gist) bool) ([]*Gist, error) {
+	gists := []*Gist{}
+	err := x.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(updatedBucket).Cursor()
+		for k, id := c.Last(); k != nil; k, id = c.Prev() {
+			g, err := get(tx, string(id))
+			if err != nil {
+				return err
+			}
+			if filter(g) {
+				gists = append(gists, g)
+			}
+		}
+		return nil
+	})
+	return gists, err
+}
+
+// Forks returns the direct forks of id which pass filter.
+func (x *Index) Forks(id string, filter func(g *Gist) bool) ([]*Gist, error) {
+	return x.List(func(g *Gist) bool {
+		return g.Parent == id && filter(g)
+	})
+}
+
+// Outdated reports whether the index was never completely built by this version, so it needs Reindex.
+func (x *Index) Outdated() (bool, error) {
+	outdated := true
+	err := x.db.View(func(tx *bolt.Tx) error {
+		outdated = bytes.Equal(tx.Bucket(metaBucket).Get(versionKey), version) == false
+		return nil
+	})
+	return outdated, err
+}
+
+// Reindex rebuilds the index from every repository of maker. Repositories are visited
+// in the order of their ids, and the last visited id is committed with each gist,
+// so an interrupted run continues where it stopped unless restart is given.
+// progress is called after each repository, it may be nil.
+func (x *Index) Reindex(maker repo.RepoMaker, restart bool, progress func(done, total int, id string)) error {
+	ids, err := maker.List()
+	if err != nil {
+		return err
+	}
+	sort.Strings(ids)
+
+	var cursor []byte
+	err = x.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if restart {
+			return meta.Delete(cursorKey)
+		}
+		cursor = append(cursor, meta.Get(cursorKey)...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		if 0 < len(cursor) && bytes.Compare([]byte(id), cursor) <= 0 {
+			continue
+		}
+		g, doc, err := load(maker, id)
+		err = x.db.Update(func(tx *bolt.Tx) error {
+			if err != nil {
+				// a broken repository must not stop the others, it is left out of the index.
+				log.Warnf("skip %s: %v", id, err)
+				if err := remove(tx, id); err != nil {
+					return err
+				}
+			} else if err := put(tx, g, doc); err != nil {
+				return err
+			}
+			if err := tx.Bucket(dirtyBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+			return tx.Bucket(metaBucket).Put(cursorKey, []byte(id))
+		})
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i+1, len(ids), id)
+		}
+	}
+
+	// forget the gists whose repositories are gone, then the run is complete.
+	return x.db.Update(func(tx *bolt.Tx) error {
+		exists := map[string]bool{}
+		for _, id := range ids {
+			exists[id] = true
+		}
+		gone := []string{}
+		err := tx.Bucket(gistsBucket).ForEach(func(k, _ []byte) error {
+			if exists[string(k)] == false {
+				gone = append(gone, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range gone {
+			if err := remove(tx, id); err != nil {
+				return err
+			}
+			if err := tx.Bucket(dirtyBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		meta := tx.Bucket(metaBucket)
+		if err := meta.Put(versionKey, version); err != nil {
+			return err
+		}
+		return meta.Delete(cursorKey)
+	})
+}
+
+func load(maker repo.RepoMaker, id string) (*Gist, document, error) {
+	r, err := maker.LoadRepo(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return collect(r)
+}
@@ -0,0 +1,267 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package index_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var _ = Describe("Index", func() {
+	var (
+		c     config.Config
+		maker repo.RepoMaker
+		idx   *Index
+		root  string
+	)
+	BeforeEach(func() {
+		c = config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "index")
+		Expect(err).To(BeNil())
+		root = p
+		c.Repo = filepath.Join(p, "repo")
+		c.Index = filepath.Join(p, "index.db")
+		maker = repo.New(c)
+		idx, err = Open(c)
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		Expect(idx.Close()).To(BeNil())
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	makeGist := func(owner string, v repo.Visibility, files ...string) repo.Repo {
+		r, err := maker.MakeRepo()
+		Expect(err).To(BeNil())
+		Expect(r.ApplyDesc("desc of " + owner)).To(BeNil())
+		Expect(r.ApplyOwner(owner)).To(BeNil())
+		Expect(r.ApplyVisibility(v)).To(BeNil())
+		for _, f := range files {
+			Expect(r.Add(f, "content of "+f)).To(BeNil())
+		}
+		Expect(r.Commit(owner, owner+"@example.com")).To(BeNil())
+		return r
+	}
+	ids := func(gists []*Gist) []string {
+		s := []string{}
+		for _, g := range gists {
+			s = append(s, g.Id)
+		}
+		return s
+	}
+	all := func(g *Gist) bool { return true }
+
+	It("sync metadata of repositories", func() {
+		r := makeGist("moge", repo.Public, "main.go", "Makefile", "util.go")
+		Expect(idx.Sync(r)).To(BeNil())
+
+		g, err := idx.Get(r.Id())
+		Expect(err).To(BeNil())
+		Expect(g.Owner).To(Equal("moge"))
+		Expect(g.Visibility).To(Equal(repo.Public))
+		Expect(g.Description).To(Equal("desc of moge"))
+		Expect(g.Files).To(Equal([]File{
+			{"Makefile", "Makefile", "text/plain", 19},
+			{"main.go", "Go", "text/plain", 18},
+			{"util.go", "Go", "text/plain", 18},
+		}))
+		Expect(g.Languages()).To(Equal([]string{"Makefile", "Go"}))
+		Expect(g.Created.IsZero()).To(BeFalse())
+
+		Expect(r.ApplyVisibility(repo.Private)).To(BeNil())
+		Expect(idx.Sync(r)).To(BeNil())
+		g, err = idx.Get(r.Id())
+		Expect(err).To(BeNil())
+		Expect(g.Visibility).To(Equal(repo.Private))
+
+		listing, err := idx.List(all)
+		Expect(err).To(BeNil())
+		Expect(ids(listing)).To(Equal([]string{r.Id()}))
+
+		Expect(idx.Remove(r.Id())).To(BeNil())
+		_, err = idx.Get(r.Id())
+		Expect(err).To(Equal(GistNotFound))
+		listing, err = idx.List(all)
+		Expect(err).To(BeNil())
+		Expect(listing).To(BeEmpty())
+	})
+
+	It("list the most recently updated first", func() {
+		older := makeGist("moge", repo.Public, "a.txt")
+		Expect(idx.Sync(older)).To(BeNil())
+		time.Sleep(1100 * time.Millisecond)
+		newer := makeGist("hoge", repo.Secret, "b.txt")
+		Expect(idx.Sync(newer)).To(BeNil())
+
+		listing, err := idx.List(all)
+		Expect(err).To(BeNil())
+		Expect(ids(listing)).To(Equal([]string{newer.Id(), older.Id()}))
+
+		listing, err = idx.List(func(g *Gist) bool { return g.Visibility == repo.Public })
+		Expect(err).To(BeNil())
+		Expect(ids(listing)).To(Equal([]string{older.Id()}))
+
+		fork, err := maker.ForkRepo(older.Id(), "way")
+		Expect(err).To(BeNil())
+		Expect(idx.Sync(fork)).To(BeNil())
+		forks, err := idx.Forks(older.Id(), all)
+		Expect(err).To(BeNil())
+		Expect(ids(forks)).To(Equal([]string{fork.Id()}))
+	})
+
+	It("rebuild from repositories and resume an interrupted run", func() {
+		expected := []string{}
+		for i := 0; i < 3; i++ {
+			expected = append(expected, makeGist("moge", repo.Public, "a.txt").Id())
+		}
+		sort.Strings(expected)
+		stale := makeGist("hoge", repo.Public, "b.txt")
+		Expect(idx.Sync(stale)).To(BeNil())
+		Expect(maker.RemoveRepo(stale.Id())).To(BeNil())
+
+		// stop after the first repository, as if the process was killed
+		func() {
+			defer func() { Expect(recover()).NotTo(BeNil()) }()
+			idx.Reindex(maker, false, func(done, total int, id string) {
+				panic("interrupted")
+			})
+		}()
+		Expect(idx.Close()).To(BeNil())
+		var err error
+		idx, err = Open(c)
+		Expect(err).To(BeNil())
+		outdated, err := idx.Outdated()
+		Expect(err).To(BeNil())
+		Expect(outdated).To(BeTrue())
+		_, err = idx.Get(expected[0])
+		Expect(err).To(BeNil())
+
+		visited := []string{}
+		Expect(idx.Reindex(maker, false, func(done, total int, id string) {
+			Expect(total).To(Equal(3))
+			visited = append(visited, id)
+		})).To(BeNil())
+		Expect(visited).To(Equal(expected[1:]))
+		outdated, err = idx.Outdated()
+		Expect(err).To(BeNil())
+		Expect(outdated).To(BeFalse())
+
+		listing, err := idx.List(all)
+		Expect(err).To(BeNil())
+		found := ids(listing)
+		sort.Strings(found)
+		Expect(found).To(Equal(expected))
+
+		visited = []string{}
+		Expect(idx.Reindex(maker, false, func(done, total int, id string) {
+			visited = append(visited, id)
+		})).To(BeNil())
+		Expect(visited).To(Equal(expected))
+	})
+
+	It("sync failed gists again after the next sync", func() {
+		r := makeGist("moge", repo.Public, "a.txt")
+		Expect(idx.Sync(r)).To(BeNil())
+		Expect(r.Add("b.txt", "content of b.txt")).To(BeNil())
+		Expect(r.Commit("moge", "moge@example.com")).To(BeNil())
+
+		// the repository is out of reach for a moment
+		p := filepath.Join(c.Repo, r.Id())
+		Expect(os.Rename(p, p+".moved")).To(BeNil())
+		Expect(idx.Sync(r)).NotTo(BeNil())
+		dirty, err := idx.Dirty()
+		Expect(err).To(BeNil())
+		Expect(dirty).To(Equal([]string{r.Id()}))
+		Expect(os.Rename(p+".moved", p)).To(BeNil())
+
+		gone := makeGist("hoge", repo.Public, "c.txt")
+		Expect(idx.Sync(gone)).To(BeNil())
+		Expect(maker.RemoveRepo(gone.Id())).To(BeNil())
+		Expect(idx.Sync(gone)).NotTo(BeNil())
+
+		Expect(idx.Sync(makeGist("fuga", repo.Public, "d.txt"))).To(BeNil())
+		dirty, err = idx.Dirty()
+		Expect(err).To(BeNil())
+		Expect(dirty).To(BeEmpty())
+		g, err := idx.Get(r.Id())
+		Expect(err).To(BeNil())
+		Expect(g.Files).To(HaveLen(2))
+		_, err = idx.Get(gone.Id())
+		Expect(err).To(Equal(GistNotFound))
+	})
+
+	It("sync marked gists which never reached a sync", func() {
+		r := makeGist("moge", repo.Public, "a.txt")
+		Expect(idx.Sync(r)).To(BeNil())
+		Expect(idx.Mark(r.Id())).To(BeNil())
+		Expect(r.Add("b.txt", "content of b.txt")).To(BeNil())
+		Expect(r.Commit("moge", "moge@example.com")).To(BeNil())
+		// the change is in progress, other syncs leave it to its own sync
+		Expect(idx.Sync(makeGist("hoge", repo.Public, "c.txt"))).To(BeNil())
+		dirty, err := idx.Dirty()
+		Expect(err).To(BeNil())
+		Expect(dirty).To(Equal([]string{r.Id()}))
+
+		// the process stops here
+		Expect(idx.Close()).To(BeNil())
+		idx, err = Open(c)
+		Expect(err).To(BeNil())
+
+		Expect(idx.Sync(makeGist("fuga", repo.Public, "c.txt"))).To(BeNil())
+		g, err := idx.Get(r.Id())
+		Expect(err).To(BeNil())
+		Expect(g.Files).To(HaveLen(2))
+		dirty, err = idx.Dirty()
+		Expect(err).To(BeNil())
+		Expect(dirty).To(BeEmpty())
+	})
+
+	It("leave gists marked again while they are read to the later sync", func() {
+		r := makeGist("moge", repo.Public, "a.txt")
+		Expect(idx.Sync(&marking{r, idx})).To(BeNil())
+		_, err := idx.Get(r.Id())
+		Expect(err).To(Equal(GistNotFound))
+		dirty, err := idx.Dirty()
+		Expect(err).To(BeNil())
+		Expect(dirty).To(Equal([]string{r.Id()}))
+
+		Expect(idx.Sync(r)).To(BeNil())
+		g, err := idx.Get(r.Id())
+		Expect(err).To(BeNil())
+		Expect(g.Revision).NotTo(BeEmpty())
+		Expect(g.Files).To(Equal([]File{{"a.txt", "Text", "text/plain", 16}}))
+	})
+})
+
+// marking marks the gist again while the index reads it, like a concurrent change does.
+type marking struct {
+	repo.Repo
+	idx *Index
+}
+
+func (m *marking) Owner() (string, error) {
+	Expect(m.idx.Mark(m.Id())).To(BeNil())
+	return m.Repo.Owner()
+}
@@ -0,0 +1,299 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package index
+
+import (
+	"github.com/taichi/gotive/server/org"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search, every term must match and so must every filter.
+//
+//	foo "exact phrase" language:go user:alice filename:Makefile
+type Query struct {
+	// Terms are phrases of words, a single word is a phrase of one.
+	Terms     [][]string
+	Languages []string
+	Users     []string
+	Filenames []string
+}
+
+var filters = map[string]func(q *Query, value string){
+	"language": func(q *Query, v string) { q.Languages = append(q.Languages, v) },
+	"user":     func(q *Query, v string) { q.Users = append(q.Users, v) },
+	"filename": func(q *Query, v string) { q.Filenames = append(q.Filenames, v) },
+}
+
+func ParseQuery(s string) *Query {
+	q := &Query{}
+	for _, w := range splitQuery(s) {
+		if kv := strings.SplitN(w, ":", 2); len(kv) == 2 && 0 < len(kv[1]) {
+			if f, ok := filters[strings.ToLower(kv[0])]; ok {
+				f(q, strings.Trim(kv[1], `"`))
+				continue
+			}
+		}
+		if words := terms(strings.Trim(w, `"`)); 0 < len(words) {
+			q.Terms = append(q.Terms, words)
+		}
+	}
+	return q
+}
+
+// splitQuery splits s by spaces, which are kept inside double quotes.
+func splitQuery(s string) []string {
+	words := []string{}
+	quoted := false
+	start := -1
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			if start < 0 {
+				start = i
+			}
+		case unicode.IsSpace(r) && quoted == false:
+			if 0 <= start {
+				words = append(words, s[start:i])
+				start = -1
+			}
+		case start < 0:
+			start = i
+		}
+	}
+	if 0 <= start {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// Empty reports whether q neither searches nor filters anything.
+func (q *Query) Empty() bool {
+	return len(q.Terms) < 1 && len(q.Languages) < 1 && len(q.Users) < 1 && len(q.Filenames) < 1
+}
+
+// Matches reports whether g passes the filters of q.
+func (q *Query) Matches(g *Gist) bool {
+	for _, l := range q.Languages {
+		if anyFile(g, func(f File) bool { return strings.EqualFold(f.Language, l) }) == false {
+			return false
+		}
+	}
+	for _, u := range q.Users {
+		owner := g.Owner
+		if name, ok := org.ParseOwner(owner); ok {
+			owner = name
+		}
+		if owner != u {
+			return false
+		}
+	}
+	for _, n := range q.Filenames {
+		pattern := strings.ToLower(n)
+		if anyFile(g, func(f File) bool {
+			base := strings.ToLower(path.Base(f.Name))
+			ok, _ := path.Match(pattern, base)
+			return ok || base == pattern
+		}) == false {
+			return false
+		}
+	}
+	return true
+}
+
+func anyFile(g *Gist, fn func(f File) bool) bool {
+	for _, f := range g.Files {
+		if fn(f) {
+			return true
+		}
+	}
+	return false
+}
+
+type token struct {
+	term string
+	// pos counts the words before, long ones too, so phrases never span a skipped word.
+	pos        int
+	start, end int
+}
+
+// maxTerm is the longest word indexed, longer ones are rather data than words.
+const maxTerm = 64
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// tokens splits text into lower cased words, with their positions and byte offsets.
+func tokens(text string) []token {
+	ts := []token{}
+	start, pos := -1, 0
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		if end-start <= maxTerm {
+			ts = append(ts, token{strings.ToLower(text[start:end]), pos, start, end})
+		}
+		start = -1
+		pos++
+	}
+	for i, r := range text {
+		if isWord(r) {
+			if start < 0 {
+				start = i
+			}
+		} else {
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return ts
+}
+
+func terms(text string) []string {
+	words := []string{}
+	for _, t := range tokens(text) {
+		words = append(words, t.term)
+	}
+	return words
+}
+
+// Highlight returns the byte ranges of text which are words of q.
+func (q *Query) Highlight(text string) [][2]int {
+	words := map[string]bool{}
+	for _, phrase := range q.Terms {
+		for _, w := range phrase {
+			words[w] = true
+		}
+	}
+	indices := [][2]int{}
+	for _, t := range tokens(text) {
+		if words[t.term] {
+			indices = append(indices, [2]int{t.start, t.end})
+		}
+	}
+	return indices
+}
+
+// Snippet is a few lines of a file around a match.
+type Snippet struct {
+	// Line is the number of the first line of Fragment, counted from 1.
+	Line     int
+	Fragment string
+	// Indices are the byte ranges of the matches in Fragment.
+	Indices [][2]int
+}
+
+// Snippets returns up to max fragments of content around the lines which match q,
+// with a line of context on each side.
+func (q *Query) Snippets(content string, max int) []Snippet {
+	return cut(content, q.Highlight, 1, max)
+}
+
+// maxFragment bounds the lines of a fragment, which close matches share.
+const maxFragment = 10
+
+// cut returns up to max fragments of content around the lines where match finds something,
+// with context lines on each side.
+func cut(content string, match func(line string) [][2]int, context, max int) []Snippet {
+	lines := strings.Split(content, "\n")
+	windows := [][2]int{}
+	for i, line := range lines {
+		if len(match(line)) < 1 {
+			continue
+		}
+		from, to := i-context, i+context+1
+		if from < 0 {
+			from = 0
+		}
+		if len(lines) < to {
+			to = len(lines)
+		}
+		if n := len(windows); 0 < n && from <= windows[n-1][1] {
+			if to-windows[n-1][0] <= maxFragment {
+				windows[n-1][1] = to
+				continue
+			}
+			from = windows[n-1][1]
+		}
+		if len(windows) == max {
+			break
+		}
+		windows = append(windows, [2]int{from, to})
+	}
+	snippets := []Snippet{}
+	for _, w := range windows {
+		s := Snippet{Line: w[0] + 1, Fragment: strings.Join(lines[w[0]:w[1]], "\n"), Indices: [][2]int{}}
+		offset := 0
+		for _, line := range lines[w[0]:w[1]] {
+			for _, ix := range match(line) {
+				s.Indices = append(s.Indices, [2]int{ix[0] + offset, ix[1] + offset})
+			}
+			offset += len(line) + 1
+		}
+		snippets = append(snippets, s)
+	}
+	return snippets
+}
+
+// Segment is a piece of highlighted text, for templates which must escape the text.
+type Segment struct {
+	Text  string
+	Match bool
+}
+
+// Segments cuts text at the ranges of indices.
+func Segments(text string, indices [][2]int) []Segment {
+	segments := []Segment{}
+	last := 0
+	for _, ix := range indices {
+		if last < ix[0] {
+			segments = append(segments, Segment{Text: text[last:ix[0]]})
+		}
+		segments = append(segments, Segment{Text: text[ix[0]:ix[1]], Match: true})
+		last = ix[1]
+	}
+	if last < len(text) {
+		segments = append(segments, Segment{Text: text[last:]})
+	}
+	return segments
+}
+
+// SnippetLine is a line of a snippet, for templates which number the lines.
+type SnippetLine struct {
+	Number   int
+	Segments []Segment
+}
+
+func (s Snippet) Lines() []SnippetLine {
+	lines := []SnippetLine{}
+	start := 0
+	for i, text := range strings.Split(s.Fragment, "\n") {
+		end := start + len(text)
+		indices := [][2]int{}
+		for _, ix := range s.Indices {
+			if start <= ix[0] && ix[1] <= end {
+				indices = append(indices, [2]int{ix[0] - start, ix[1] - start})
+			}
+		}
+		lines = append(lines, SnippetLine{Number: s.Line + i, Segments: Segments(text, indices)})
+		start = end + 1
+	}
+	return lines
+}
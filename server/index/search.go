@@ -0,0 +1,258 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	bolt "go.etcd.io/bbolt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	descriptionField = "description"
+	filenameField    = "filename:"
+	contentField     = "content:"
+)
+
+// maxContent is the largest file whose content is searched.
+const maxContent = 512 * 1024
+
+// document is the searchable text of a gist by field, files have a field for the name and one for the content.
+type document map[string]string
+
+// add makes the name of a file searchable, and the content unless it is binary or large.
+func (doc document) add(name string, content []byte) {
+	doc[filenameField+name] = name
+	if len(content) <= maxContent && bytes.IndexByte(content, 0) < 0 {
+		doc[contentField+name] = string(content)
+	}
+}
+
+// weight prefers matches in descriptions, then in file names, to matches in contents.
+func weight(field string) float64 {
+	switch {
+	case field == descriptionField:
+		return 3
+	case strings.HasPrefix(field, filenameField):
+		return 2
+	}
+	return 1
+}
+
+// positions are where a term appears, by field.
+type positions map[string][]int
+
+func postingKey(term, id string) []byte {
+	return []byte(term + "\x00" + id)
+}
+
+// putPostings indexes every word of doc, and remembers the words to remove them later.
+func putPostings(tx *bolt.Tx, id string, doc document) error {
+	postings := map[string]positions{}
+	for field, text := range doc {
+		for _, t := range tokens(text) {
+			p, ok := postings[t.term]
+			if ok == false {
+				p = positions{}
+				postings[t.term] = p
+			}
+			p[field] = append(p[field], t.pos)
+		}
+	}
+	b := tx.Bucket(postingsBucket)
+	words := []string{}
+	for term, p := range postings {
+		v, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(postingKey(term, id), v); err != nil {
+			return err
+		}
+		words = append(words, term)
+	}
+	v, err := json.Marshal(words)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(termsBucket).Put([]byte(id), v)
+}
+
+func removePostings(tx *bolt.Tx, id string) error {
+	v := tx.Bucket(termsBucket).Get([]byte(id))
+	if v == nil {
+		return nil
+	}
+	words := []string{}
+	if err := json.Unmarshal(v, &words); err != nil {
+		return err
+	}
+	b := tx.Bucket(postingsBucket)
+	for _, term := range words {
+		if err := b.Delete(postingKey(term, id)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(termsBucket).Delete([]byte(id))
+}
+
+// lookup returns where term appears, by gist id.
+func lookup(tx *bolt.Tx, term string) (map[string]positions, error) {
+	found := map[string]positions{}
+	prefix := []byte(term + "\x00")
+	c := tx.Bucket(postingsBucket).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		p := positions{}
+		if err := json.Unmarshal(v, &p); err != nil {
+			return nil, err
+		}
+		found[string(k[len(prefix):])] = p
+	}
+	return found, nil
+}
+
+// occurrences counts the phrase in each field of each gist, by gist id.
+func occurrences(tx *bolt.Tx, phrase []string) (map[string]map[string]int, error) {
+	hits := []map[string]positions{}
+	for _, w := range phrase {
+		found, err := lookup(tx, w)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, found)
+	}
+	counts := map[string]map[string]int{}
+	for id, first := range hits[0] {
+		for field, starts := range first {
+			n := 0
+			for _, start := range starts {
+				if follows(hits[1:], id, field, start) {
+					n++
+				}
+			}
+			if 0 < n {
+				if counts[id] == nil {
+					counts[id] = map[string]int{}
+				}
+				counts[id][field] = n
+			}
+		}
+	}
+	return counts, nil
+}
+
+// follows reports whether the rest of a phrase appears right after start.
+func follows(rest []map[string]positions, id, field string, start int) bool {
+	for i, found := range rest {
+		if contains(found[id][field], start+i+1) == false {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(sorted []int, n int) bool {
+	i := sort.SearchInts(sorted, n)
+	return i < len(sorted) && sorted[i] == n
+}
+
+// Result is a gist found by Search.
+type Result struct {
+	Gist  *Gist
+	Score float64
+	// Files are the files whose name or content matched, in the order of the gist.
+	Files []string
+}
+
+// Search returns the gists which match q and pass filter, the best first.
+// A query without terms lists the gists passing the filters, the most recently updated first.
+func (x *Index) Search(q *Query, filter func(g *Gist) bool) ([]*Result, error) {
+	results := []*Result{}
+	if q.Empty() {
+		return results, nil
+	}
+	if len(q.Terms) < 1 {
+		gists, err := x.List(func(g *Gist) bool { return q.Matches(g) && filter(g) })
+		for _, g := range gists {
+			results = append(results, &Result{Gist: g, Files: []string{}})
+		}
+		return results, err
+	}
+	err := x.db.View(func(tx *bolt.Tx) error {
+		total := float64(tx.Bucket(gistsBucket).Stats().KeyN)
+		scores := map[string]float64{}
+		matched := map[string]map[string]bool{}
+		for i, phrase := range q.Terms {
+			counts, err := occurrences(tx, phrase)
+			if err != nil {
+				return err
+			}
+			idf := math.Log(1 + total/float64(len(counts)+1))
+			next := map[string]float64{}
+			for id, fields := range counts {
+				if _, ok := scores[id]; i != 0 && ok == false {
+					continue
+				}
+				s := scores[id]
+				for field, tf := range fields {
+					s += idf * weight(field) * float64(tf) / (float64(tf) + 1.2)
+					if matched[id] == nil {
+						matched[id] = map[string]bool{}
+					}
+					matched[id][field] = true
+				}
+				next[id] = s
+			}
+			scores = next
+		}
+		for id, score := range scores {
+			g, err := get(tx, id)
+			if err != nil {
+				return err
+			}
+			if q.Matches(g) == false || filter(g) == false {
+				continue
+			}
+			files := []string{}
+			for _, f := range g.Files {
+				if matched[id][filenameField+f.Name] || matched[id][contentField+f.Name] {
+					files = append(files, f.Name)
+				}
+			}
+			results = append(results, &Result{Gist: g, Score: score, Files: files})
+		}
+		return nil
+	})
+	sort.Sort(byScore(results))
+	return results, err
+}
+
+type byScore []*Result
+
+func (b byScore) Len() int      { return len(b) }
+func (b byScore) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byScore) Less(i, j int) bool {
+	if b[i].Score != b[j].Score {
+		return b[j].Score < b[i].Score
+	}
+	if b[i].Gist.Updated.Equal(b[j].Gist.Updated) == false {
+		return b[j].Gist.Updated.Before(b[i].Gist.Updated)
+	}
+	return b[i].Gist.Id < b[j].Gist.Id
+}
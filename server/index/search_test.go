@@ -0,0 +1,151 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package index_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Describe("Query", func() {
+	It("parse terms, phrases and filters", func() {
+		q := ParseQuery(`Hello "exact  phrase" main.go language:Go user:alice filename:"Make file" unknown:x`)
+		Expect(q.Terms).To(Equal([][]string{{"hello"}, {"exact", "phrase"}, {"main", "go"}, {"unknown", "x"}}))
+		Expect(q.Languages).To(Equal([]string{"Go"}))
+		Expect(q.Users).To(Equal([]string{"alice"}))
+		Expect(q.Filenames).To(Equal([]string{"Make file"}))
+		Expect(ParseQuery("  ").Empty()).To(BeTrue())
+	})
+
+	It("filter gists", func() {
+		g := &Gist{Owner: "org:acme", Files: []File{{Name: "src/main.go", Language: "Go"}, {Name: "Makefile", Language: "Makefile"}}}
+		Expect(ParseQuery("language:go").Matches(g)).To(BeTrue())
+		Expect(ParseQuery("language:ruby").Matches(g)).To(BeFalse())
+		Expect(ParseQuery("user:acme").Matches(g)).To(BeTrue())
+		Expect(ParseQuery("user:alice").Matches(g)).To(BeFalse())
+		Expect(ParseQuery("filename:makefile").Matches(g)).To(BeTrue())
+		Expect(ParseQuery("filename:*.go").Matches(g)).To(BeTrue())
+		Expect(ParseQuery("filename:main.rb").Matches(g)).To(BeFalse())
+	})
+
+	It("highlight and cut snippets", func() {
+		q := ParseQuery("foo")
+		Expect(q.Highlight("a Foo and foobar foo")).To(Equal([][2]int{{2, 5}, {17, 20}}))
+		Expect(Segments("a foo b", [][2]int{{2, 5}})).To(Equal([]Segment{{"a ", false}, {"foo", true}, {" b", false}}))
+
+		snippets := q.Snippets("1\n2\nfoo 3\n4\n5\n6\n7 foo\n8", 5)
+		Expect(snippets).To(Equal([]Snippet{
+			{Line: 2, Fragment: "2\nfoo 3\n4", Indices: [][2]int{{2, 5}}},
+			{Line: 6, Fragment: "6\n7 foo\n8", Indices: [][2]int{{4, 7}}},
+		}))
+		Expect(q.Snippets("foo\nfoo\nfoo\nfoo\nfoo", 1)).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Search", func() {
+	var (
+		maker repo.RepoMaker
+		idx   *Index
+		root  string
+	)
+	BeforeEach(func() {
+		c := config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "search")
+		Expect(err).To(BeNil())
+		root = p
+		c.Repo = filepath.Join(p, "repo")
+		c.Index = filepath.Join(p, "index.db")
+		maker = repo.New(c)
+		idx, err = Open(c)
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		Expect(idx.Close()).To(BeNil())
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	makeGist := func(owner, desc string, files map[string]string) repo.Repo {
+		r, err := maker.MakeRepo()
+		Expect(err).To(BeNil())
+		Expect(r.ApplyDesc(desc)).To(BeNil())
+		Expect(r.ApplyOwner(owner)).To(BeNil())
+		Expect(r.ApplyVisibility(repo.Public)).To(BeNil())
+		for name, content := range files {
+			Expect(r.Add(name, content)).To(BeNil())
+		}
+		Expect(r.Commit(owner, owner+"@example.com")).To(BeNil())
+		Expect(idx.Sync(r)).To(BeNil())
+		return r
+	}
+	all := func(g *Gist) bool { return true }
+	search := func(q string) []string {
+		results, err := idx.Search(ParseQuery(q), all)
+		Expect(err).To(BeNil())
+		ids := []string{}
+		for _, r := range results {
+			ids = append(ids, r.Gist.Id)
+		}
+		return ids
+	}
+
+	It("find gists by words, phrases and filters", func() {
+		hello := makeGist("alice", "say hello", map[string]string{"main.go": "package main\n\nfunc main() {\n\tprintln(\"hello world\")\n}\n"})
+		build := makeGist("bob", "build tools", map[string]string{"Makefile": "all:\n\tgo build\n", "run.sh": "echo world hello\n"})
+
+		Expect(search("hello")).To(Equal([]string{hello.Id(), build.Id()}))
+		Expect(search(`"hello world"`)).To(Equal([]string{hello.Id()}))
+		Expect(search(`"world hello"`)).To(Equal([]string{build.Id()}))
+		Expect(search("hello build")).To(Equal([]string{build.Id()}))
+		Expect(search("hello language:shell")).To(Equal([]string{build.Id()}))
+		Expect(search("hello user:alice")).To(Equal([]string{hello.Id()}))
+		Expect(search("filename:Makefile")).To(Equal([]string{build.Id()}))
+		Expect(search("nothing")).To(BeEmpty())
+
+		results, err := idx.Search(ParseQuery("hello"), func(g *Gist) bool { return g.Owner == "bob" })
+		Expect(err).To(BeNil())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Files).To(Equal([]string{"run.sh"}))
+	})
+
+	It("never match phrases across long words", func() {
+		long := strings.Repeat("x", 65)
+		r := makeGist("alice", "", map[string]string{"a.txt": "hello " + long + " world\n"})
+		Expect(search("hello world")).To(Equal([]string{r.Id()}))
+		Expect(search(`"hello world"`)).To(BeEmpty())
+	})
+
+	It("follow changes of gists", func() {
+		r := makeGist("alice", "", map[string]string{"a.txt": "old words"})
+		Expect(search("old")).To(Equal([]string{r.Id()}))
+
+		Expect(r.Update("a.txt", "new words")).To(BeNil())
+		Expect(r.Commit("alice", "alice@example.com")).To(BeNil())
+		Expect(idx.Sync(r)).To(BeNil())
+		Expect(search("old")).To(BeEmpty())
+		Expect(search("new")).To(Equal([]string{r.Id()}))
+
+		Expect(idx.Remove(r.Id())).To(BeNil())
+		Expect(search("new")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,130 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// sniffLines is how many lines at the head and the tail are looked for modelines.
+const sniffLines = 5
+
+var (
+	vimModeline   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex)(?:[<=>]?\d+)?:.*?\b(?:ft|filetype|syntax)=([\w+#-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*)?([\w+#-]+)\s*(?:;.*?)?-\*-`)
+)
+
+// byModeline reads the language from vim or emacs modelines.
+func byModeline(content []byte) (string, bool) {
+	lines := bytes.Split(content, []byte("\n"))
+	if 2*sniffLines < len(lines) {
+		lines = append(lines[:sniffLines:sniffLines], lines[len(lines)-sniffLines:]...)
+	}
+	for _, line := range lines {
+		for _, re := range []*regexp.Regexp{vimModeline, emacsModeline} {
+			if m := re.FindSubmatch(line); m != nil {
+				name := strings.TrimSuffix(strings.ToLower(string(m[1])), "-mode")
+				if l, ok := byAlias(name); ok {
+					return l, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+var interpreters = map[string]string{
+	"node":       "JavaScript",
+	"nodejs":     "JavaScript",
+	"deno":       "TypeScript",
+	"ts-node":    "TypeScript",
+	"dash":       "Shell",
+	"ksh":        "Shell",
+	"Rscript":    "R",
+	"escript":    "Erlang",
+	"elixir":     "Elixir",
+	"runhaskell": "Haskell",
+	"pwsh":       "PowerShell",
+	"php":        "PHP",
+	"perl":       "Perl",
+	"lua":        "Lua",
+	"groovy":     "Groovy",
+	"scala":      "Scala",
+	"swift":      "Swift",
+}
+
+var version = regexp.MustCompile(`[\d.]+$`)
+
+// byShebang reads the language from the interpreter of #!, also through env.
+func byShebang(content []byte) (string, bool) {
+	if bytes.HasPrefix(content, []byte("#!")) == false {
+		return "", false
+	}
+	line := string(content[2:])
+	if i := strings.IndexByte(line, '\n'); 0 <= i {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	for 0 < len(fields) {
+		name := path.Base(fields[0])
+		if name == "env" || strings.HasPrefix(name, "-") {
+			fields = fields[1:]
+			continue
+		}
+		if l, ok := interpreters[name]; ok {
+			return l, true
+		}
+		return byAlias(version.ReplaceAllString(name, ""))
+	}
+	return "", false
+}
+
+var heuristics = []struct {
+	lang    string
+	pattern *regexp.Regexp
+}{
+	{"PHP", regexp.MustCompile(`^<\?php`)},
+	{"XML", regexp.MustCompile(`^<\?xml`)},
+	{"HTML", regexp.MustCompile(`(?i)^(?:<!doctype html|<html)`)},
+	{"Diff", regexp.MustCompile(`(?m)^(?:diff --git |--- .*\n\+\+\+ )`)},
+	{"Go", regexp.MustCompile(`(?m)^package \w+\s*$[\s\S]*^func `)},
+	{"C++", regexp.MustCompile(`(?m)^#include\s*[<"][\s\S]*(?:std::|^namespace |^class )`)},
+	{"C", regexp.MustCompile(`(?m)^#include\s*[<"]`)},
+	{"Python", regexp.MustCompile(`(?m)^\s*(?:def \w+\(.*\):|from [\w.]+ import |import \w+$)`)},
+	{"Dockerfile", regexp.MustCompile(`(?m)\A(?:#.*\n|\s*\n)*FROM \S+[\s\S]*^(?:RUN|CMD|ENTRYPOINT) `)},
+	{"SQL", regexp.MustCompile(`(?i)^(?:select .* from |create table |insert into )`)},
+}
+
+// byContent guesses the language from what the content looks like.
+func byContent(content []byte) (string, bool) {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) < 1 {
+		return "", false
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return "JSON", true
+	}
+	for _, h := range heuristics {
+		if h.pattern.Match(trimmed) {
+			return h.lang, true
+		}
+	}
+	return "", false
+}
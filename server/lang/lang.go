@@ -0,0 +1,158 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lang
+
+import (
+	"path"
+	"strings"
+)
+
+// Text is the language of files nobody recognizes.
+const Text = "Text"
+
+var extensions = map[string]string{
+	".c":        "C",
+	".h":        "C",
+	".cc":       "C++",
+	".cpp":      "C++",
+	".hpp":      "C++",
+	".cs":       "C#",
+	".clj":      "Clojure",
+	".coffee":   "CoffeeScript",
+	".css":      "CSS",
+	".dart":     "Dart",
+	".diff":     "Diff",
+	".patch":    "Diff",
+	".ex":       "Elixir",
+	".exs":      "Elixir",
+	".erl":      "Erlang",
+	".go":       "Go",
+	".groovy":   "Groovy",
+	".hs":       "Haskell",
+	".html":     "HTML",
+	".htm":      "HTML",
+	".ini":      "INI",
+	".java":     "Java",
+	".js":       "JavaScript",
+	".json":     "JSON",
+	".ipynb":    "Jupyter Notebook",
+	".kt":       "Kotlin",
+	".lua":      "Lua",
+	".md":       "Markdown",
+	".markdown": "Markdown",
+	".m":        "Objective-C",
+	".ml":       "OCaml",
+	".pl":       "Perl",
+	".php":      "PHP",
+	".ps1":      "PowerShell",
+	".py":       "Python",
+	".r":        "R",
+	".rb":       "Ruby",
+	".rs":       "Rust",
+	".scala":    "Scala",
+	".scss":     "SCSS",
+	".sh":       "Shell",
+	".bash":     "Shell",
+	".sql":      "SQL",
+	".swift":    "Swift",
+	".tex":      "TeX",
+	".toml":     "TOML",
+	".ts":       "TypeScript",
+	".vim":      "Vim script",
+	".xml":      "XML",
+	".yaml":     "YAML",
+	".yml":      "YAML",
+	".txt":      Text,
+}
+
+var filenames = map[string]string{
+	"Dockerfile":  "Dockerfile",
+	"Makefile":    "Makefile",
+	"GNUmakefile": "Makefile",
+	"Rakefile":    "Ruby",
+	"Gemfile":     "Ruby",
+}
+
+// Detect returns the language of a file. A modeline in the content decides first,
+// then the name, then the shebang and at last the content itself. Unknown files are Text.
+func Detect(name string, content []byte) string {
+	if l, ok := byModeline(content); ok {
+		return l
+	}
+	if l, ok := byName(name); ok {
+		return l
+	}
+	if l, ok := byShebang(content); ok {
+		return l
+	}
+	if l, ok := byContent(content); ok {
+		return l
+	}
+	return Text
+}
+
+func byName(name string) (string, bool) {
+	base := path.Base(name)
+	if l, ok := filenames[base]; ok {
+		return l, true
+	}
+	l, ok := extensions[strings.ToLower(path.Ext(base))]
+	return l, ok
+}
+
+var aliases = map[string]string{
+	"bash":       "Shell",
+	"sh":         "Shell",
+	"zsh":        "Shell",
+	"shell":      "Shell",
+	"js":         "JavaScript",
+	"javascript": "JavaScript",
+	"ts":         "TypeScript",
+	"typescript": "TypeScript",
+	"py":         "Python",
+	"python":     "Python",
+	"rb":         "Ruby",
+	"ruby":       "Ruby",
+	"cpp":        "C++",
+	"c++":        "C++",
+	"cs":         "C#",
+	"csharp":     "C#",
+	"objc":       "Objective-C",
+	"golang":     "Go",
+	"make":       "Makefile",
+	"makefile":   "Makefile",
+	"dockerfile": "Dockerfile",
+	"markdown":   "Markdown",
+	"vim":        "Vim script",
+	"text":       Text,
+}
+
+// byAlias finds a language by the names editors and interpreters call it.
+func byAlias(alias string) (string, bool) {
+	alias = strings.ToLower(alias)
+	if l, ok := aliases[alias]; ok {
+		return l, true
+	}
+	if l, ok := extensions["."+alias]; ok {
+		return l, true
+	}
+	for _, l := range extensions {
+		if strings.ToLower(l) == alias {
+			return l, true
+		}
+	}
+	return "", false
+}
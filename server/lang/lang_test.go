@@ -0,0 +1,54 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lang_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taichi/gotive/server/lang"
+)
+
+var _ = Describe("Lang", func() {
+	It("detect languages by file names", func() {
+		Expect(Detect("main.go", nil)).To(Equal("Go"))
+		Expect(Detect("src/App.JAVA", nil)).To(Equal("Java"))
+		Expect(Detect("Makefile", nil)).To(Equal("Makefile"))
+		Expect(Detect("dir/Dockerfile", nil)).To(Equal("Dockerfile"))
+		Expect(Detect("notes", nil)).To(Equal(Text))
+		Expect(Detect("archive.unknown", nil)).To(Equal(Text))
+	})
+
+	It("detect languages by shebangs and modelines", func() {
+		Expect(Detect("run", []byte("#!/bin/sh\necho hi\n"))).To(Equal("Shell"))
+		Expect(Detect("run", []byte("#!/usr/bin/env python3.11\nprint(1)\n"))).To(Equal("Python"))
+		Expect(Detect("run", []byte("#!/usr/bin/env -S node --no-warnings\n"))).To(Equal("JavaScript"))
+		Expect(Detect("run", []byte("#!/opt/unknown\n"))).To(Equal(Text))
+		Expect(Detect("build.txt", []byte("task :default\n# vim: set ft=ruby :\n"))).To(Equal("Ruby"))
+		Expect(Detect("a.conf", []byte("# -*- mode: python; coding: utf-8 -*-\n"))).To(Equal("Python"))
+		Expect(Detect("a.conf", []byte(";; -*- coding: utf-8 -*-\n"))).To(Equal(Text))
+	})
+
+	It("detect languages by contents", func() {
+		Expect(Detect("snippet", []byte("package main\n\nfunc main() {}\n"))).To(Equal("Go"))
+		Expect(Detect("snippet", []byte(" {\"a\": [1, 2]}"))).To(Equal("JSON"))
+		Expect(Detect("snippet", []byte("<?php echo 1;"))).To(Equal("PHP"))
+		Expect(Detect("snippet", []byte("#include <stdio.h>\nint main() {}\n"))).To(Equal("C"))
+		Expect(Detect("snippet", []byte("#include <vector>\nstd::vector<int> v;\n"))).To(Equal("C++"))
+		Expect(Detect("snippet", []byte("def hello(name):\n    print(name)\n"))).To(Equal("Python"))
+		Expect(Detect("snippet", []byte("FROM golang:1.20\nRUN go build\n"))).To(Equal("Dockerfile"))
+		Expect(Detect("snippet", []byte("just some words\n"))).To(Equal(Text))
+	})
+})
@@ -0,0 +1,119 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/taichi/gotive/server/highlight"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"html/template"
+	"regexp"
+)
+
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	// raw html is written as is, policy removes what is unsafe.
+	goldmark.WithRendererOptions(html.WithUnsafe(), renderer.WithNodeRenderers(util.Prioritized(&nodeRenderer{}, 100))),
+)
+
+var policy = newPolicy()
+
+// newPolicy allows classes of highlighted code and of languages only, so documents never borrow the style of the page.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^anchor$`)).OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(highlight.Classes).OnElements("pre", "span")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+	return p
+}
+
+// idPrefix keeps ids of documents apart from the ids of the page around them.
+const idPrefix = "user-content-"
+
+// idAttr finds id attributes, sanitized html escapes every quote of texts and values,
+// so they are found only in tags. Ids which have the prefix already keep it once.
+var idAttr = regexp.MustCompile(` id="(` + idPrefix + `)?`)
+
+// Render converts GitHub flavored markdown to sanitized html.
+func Render(source []byte) (template.HTML, error) {
+	var b bytes.Buffer
+	if err := md.Convert(source, &b); err != nil {
+		return "", err
+	}
+	return template.HTML(PrefixIds(policy.SanitizeBytes(b.Bytes()))), nil
+}
+
+// PrefixIds prefixes the ids of sanitized html with user-content-.
+func PrefixIds(h []byte) []byte {
+	return idAttr.ReplaceAll(h, []byte(` id="`+idPrefix))
+}
+
+// nodeRenderer highlights fenced code and links headings to themselves.
+type nodeRenderer struct{}
+
+func (r *nodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.fencedCode)
+	reg.Register(ast.KindHeading, r.heading)
+}
+
+func (r *nodeRenderer) fencedCode(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering == false {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		l := lines.At(i)
+		code.Write(l.Value(source))
+	}
+	h, err := highlight.Block(string(n.Language(source)), code.String())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	w.WriteString(string(h))
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *nodeRenderer) heading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Heading)
+	if entering == false {
+		fmt.Fprintf(w, "</h%d>\n", n.Level)
+		return ast.WalkContinue, nil
+	}
+	fmt.Fprintf(w, "<h%d", n.Level)
+	if id, ok := n.AttributeString("id"); ok {
+		if b, ok := id.([]byte); ok {
+			e := util.EscapeHTML(b)
+			fmt.Fprintf(w, ` id="%s%s"><a class="anchor" href="#%s%s">#</a>`, idPrefix, e, idPrefix, e)
+			return ast.WalkContinue, nil
+		}
+	}
+	w.WriteString(">")
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,75 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package markdown_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taichi/gotive/server/markdown"
+)
+
+func render(source string) string {
+	h, err := Render([]byte(source))
+	Expect(err).NotTo(HaveOccurred())
+	return string(h)
+}
+
+var _ = Describe("Markdown", func() {
+	It("render tables and task lists", func() {
+		h := render("| a | b |\n|---|--:|\n| 1 | 2 |\n\n- [x] done\n- [ ] todo\n")
+		Expect(h).To(ContainSubstring("<table>"))
+		Expect(h).To(ContainSubstring("<td>1</td>"))
+		Expect(h).To(ContainSubstring(`<td style="text-align: right">2</td>`))
+		Expect(h).To(ContainSubstring(`<li><input checked="" disabled="" type="checkbox"> done</li>`))
+		Expect(h).To(ContainSubstring(`<li><input disabled="" type="checkbox"> todo</li>`))
+	})
+
+	It("link urls and headings", func() {
+		h := render("# Setup Steps\n\nsee https://example.com/docs\n")
+		Expect(h).To(ContainSubstring(`<h1 id="user-content-setup-steps"><a class="anchor" href="#user-content-setup-steps"`))
+		Expect(h).To(ContainSubstring(`<a href="https://example.com/docs" rel="nofollow">`))
+	})
+
+	It("highlight fenced code", func() {
+		h := render("```go\nfunc main() {}\n```\n")
+		Expect(h).To(ContainSubstring(`<pre class="chroma">`))
+		Expect(h).To(ContainSubstring(`<span class="kd">func</span>`))
+
+		h = render("```\n<b>x</b>\n```\n")
+		Expect(h).To(ContainSubstring("&lt;b&gt;x&lt;/b&gt;"))
+	})
+
+	It("sanitize html", func() {
+		h := render("<script>alert(1)</script>\n\n<a href=\"javascript:alert(1)\" onclick=\"x()\">link</a> <b>bold</b>\n\n[x](javascript:alert(1))\n")
+		Expect(h).NotTo(ContainSubstring("<script"))
+		Expect(h).NotTo(ContainSubstring("javascript:"))
+		Expect(h).NotTo(ContainSubstring("onclick"))
+		Expect(h).To(ContainSubstring("<b>bold</b>"))
+	})
+
+	It("keep ids and classes of the page away", func() {
+		h := render("<h2 id=\"login\">x</h2>\n\n<span class=\"btn\">y</span> <span class=\"kd\">z</span> <span class=\"btn kd\">u</span> <code class=\"language-go\">w</code> <a class=\"hidden\" href=\"#\">v</a>\n")
+		Expect(h).To(ContainSubstring(`<h2 id="user-content-login">x</h2>`))
+		Expect(h).To(ContainSubstring("<span>y</span>"))
+		Expect(h).To(ContainSubstring(`<span class="kd">z</span>`))
+		Expect(h).To(ContainSubstring("<span>u</span>"))
+		Expect(h).To(ContainSubstring(`<code class="language-go">w</code>`))
+		Expect(h).NotTo(ContainSubstring("hidden"))
+
+		h = render("a <b title='x id=\"y\"'>b</b> id=\"z\"\n")
+		Expect(h).NotTo(ContainSubstring("user-content-"))
+	})
+})
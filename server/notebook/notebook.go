@@ -0,0 +1,224 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package notebook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/taichi/gotive/server/highlight"
+	"github.com/taichi/gotive/server/markdown"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// text is a multiline string of nbformat, which is either a string or a list of lines.
+type text string
+
+func (t *text) UnmarshalJSON(b []byte) error {
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err == nil {
+		*t = text(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*t = text(s)
+	return nil
+}
+
+type notebook struct {
+	Format   int `json:"nbformat"`
+	Metadata struct {
+		Kernel struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		Language struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []cell `json:"cells"`
+}
+
+type cell struct {
+	Type    string   `json:"cell_type"`
+	Count   *int     `json:"execution_count"`
+	Source  text     `json:"source"`
+	Outputs []output `json:"outputs"`
+}
+
+type output struct {
+	Type      string          `json:"output_type"`
+	Count     *int            `json:"execution_count"`
+	Name      string          `json:"name"`
+	Text      text            `json:"text"`
+	Data      map[string]text `json:"data"`
+	Error     string          `json:"ename"`
+	Value     string          `json:"evalue"`
+	Traceback []string        `json:"traceback"`
+}
+
+// language returns the language of code cells, notebooks without one are python.
+func (n *notebook) language() string {
+	if l := n.Metadata.Language.Name; l != "" {
+		return l
+	}
+	if l := n.Metadata.Kernel.Language; l != "" {
+		return l
+	}
+	return "python"
+}
+
+var page = template.Must(template.New("notebook").Parse(`<div class="notebook">
+{{range .}}<div class="cell {{.Type}}">
+{{if eq .Type "code"}}<div class="prompt">In [{{with .Count}}{{.}}{{else}} {{end}}]:</div>{{end}}
+<div class="input">{{.Input}}</div>
+{{range .Outputs}}<div class="output">{{with .Count}}<div class="prompt">Out [{{.}}]:</div>{{end}}{{.HTML}}</div>
+{{end}}</div>
+{{end}}</div>
+`))
+
+type renderedCell struct {
+	Type    string
+	Count   *int
+	Input   template.HTML
+	Outputs []renderedOutput
+}
+
+type renderedOutput struct {
+	Count *int
+	HTML  template.HTML
+}
+
+// Render converts a notebook of nbformat 4 to html.
+func Render(content []byte) (template.HTML, error) {
+	var n notebook
+	if err := json.Unmarshal(content, &n); err != nil {
+		return "", err
+	}
+	if n.Format < 4 {
+		return "", fmt.Errorf("nbformat %d is not supported", n.Format)
+	}
+	cells := []renderedCell{}
+	for _, c := range n.Cells {
+		r := renderedCell{Type: c.Type, Count: c.Count}
+		var err error
+		switch c.Type {
+		case "markdown":
+			r.Input, err = markdown.Render([]byte(c.Source))
+		case "code":
+			r.Input, err = highlight.Block(n.language(), string(c.Source))
+			for _, o := range c.Outputs {
+				h, err := renderOutput(o)
+				if err != nil {
+					return "", err
+				}
+				r.Outputs = append(r.Outputs, renderedOutput{o.Count, h})
+			}
+		default:
+			r.Input = preformatted("", string(c.Source))
+		}
+		if err != nil {
+			return "", err
+		}
+		cells = append(cells, r)
+	}
+	var b bytes.Buffer
+	if err := page.Execute(&b, cells); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+func renderOutput(o output) (template.HTML, error) {
+	switch o.Type {
+	case "stream":
+		// the name of a stream becomes a class, other than these would borrow the style of the page.
+		if o.Name == "stdout" || o.Name == "stderr" {
+			return preformatted(o.Name, string(o.Text)), nil
+		}
+		return preformatted("", string(o.Text)), nil
+	case "error":
+		if len(o.Traceback) == 0 {
+			return preformatted("error", o.Error+": "+o.Value), nil
+		}
+		return preformatted("error", ansi.ReplaceAllString(strings.Join(o.Traceback, "\n"), "")), nil
+	case "execute_result", "display_data":
+		return renderData(o.Data)
+	}
+	return "", nil
+}
+
+// images are the image types which are shown from data urls.
+var images = []string{"image/png", "image/jpeg", "image/gif", "image/svg+xml"}
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// pandas marks its tables, other classes would borrow the style of the page.
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^dataframe$`)).OnElements("table")
+	p.AllowAttrs("border").Matching(bluemonday.Integer).OnElements("table")
+	p.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+	return p
+}
+
+// renderData shows the richest representation of a result.
+func renderData(data map[string]text) (template.HTML, error) {
+	for _, t := range images {
+		if d, ok := data[t]; ok {
+			return image(t, string(d)), nil
+		}
+	}
+	if d, ok := data["text/html"]; ok {
+		return template.HTML(markdown.PrefixIds(policy.SanitizeBytes([]byte(d)))), nil
+	}
+	if d, ok := data["text/markdown"]; ok {
+		return markdown.Render([]byte(d))
+	}
+	if d, ok := data["text/plain"]; ok {
+		return preformatted("", string(d)), nil
+	}
+	return "", nil
+}
+
+var base64Data = regexp.MustCompile(`^[A-Za-z0-9+/]*=*$`)
+
+func image(typ, data string) template.HTML {
+	if typ == "image/svg+xml" {
+		data = base64.StdEncoding.EncodeToString([]byte(data))
+	} else {
+		data = strings.Join(strings.Fields(data), "")
+		if base64Data.MatchString(data) == false {
+			return ""
+		}
+	}
+	return template.HTML(fmt.Sprintf(`<img src="data:%s;base64,%s">`, typ, data))
+}
+
+func preformatted(class, s string) template.HTML {
+	if class == "" {
+		return template.HTML("<pre>" + template.HTMLEscapeString(s) + "</pre>")
+	}
+	return template.HTML(fmt.Sprintf(`<pre class="%s">%s</pre>`, template.HTMLEscapeString(class), template.HTMLEscapeString(s)))
+}
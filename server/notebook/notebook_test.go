@@ -0,0 +1,91 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package notebook_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taichi/gotive/server/notebook"
+)
+
+const nb = `{
+ "nbformat": 4,
+ "nbformat_minor": 5,
+ "metadata": {"language_info": {"name": "python"}},
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Analysis\n", "<script>alert(1)</script>"]},
+  {"cell_type": "code", "execution_count": 3, "metadata": {}, "source": "def f(x):\n    return x",
+   "outputs": [
+    {"output_type": "stream", "name": "stdout", "text": ["a < b\n"]},
+    {"output_type": "execute_result", "execution_count": 3, "metadata": {}, "data": {"text/plain": ["42"]}},
+    {"output_type": "display_data", "metadata": {}, "data": {"image/png": "iVBORw0K\nGgo=\n", "text/plain": ["<Figure>"]}},
+    {"output_type": "display_data", "metadata": {}, "data": {"text/html": ["<table class=\"dataframe\"><tr><td onclick=\"x()\">1</td></tr></table>"]}},
+    {"output_type": "error", "ename": "ValueError", "evalue": "bad", "traceback": ["\u001b[0;31mValueError\u001b[0m: bad"]}
+   ]},
+  {"cell_type": "code", "execution_count": null, "metadata": {}, "source": [], "outputs": []}
+ ]
+}`
+
+var _ = Describe("Notebook", func() {
+	var h string
+
+	BeforeEach(func() {
+		r, err := Render([]byte(nb))
+		Expect(err).NotTo(HaveOccurred())
+		h = string(r)
+	})
+
+	It("render markdown cells", func() {
+		Expect(h).To(ContainSubstring(`<h1 id="user-content-analysis">`))
+		Expect(h).NotTo(ContainSubstring("<script"))
+	})
+
+	It("highlight code cells with execution counts", func() {
+		Expect(h).To(ContainSubstring("In [3]:"))
+		Expect(h).To(ContainSubstring("In [ ]:"))
+		Expect(h).To(ContainSubstring(`<span class="k">def</span>`))
+		Expect(h).To(ContainSubstring("Out [3]:"))
+	})
+
+	It("render outputs", func() {
+		Expect(h).To(ContainSubstring(`<pre class="stdout">a &lt; b`))
+		Expect(h).To(ContainSubstring("<pre>42</pre>"))
+		Expect(h).To(ContainSubstring(`<img src="data:image/png;base64,iVBORw0KGgo=">`))
+		Expect(h).NotTo(ContainSubstring("Figure"))
+		Expect(h).To(ContainSubstring(`<table class="dataframe"><tr><td>1</td></tr></table>`))
+		Expect(h).To(ContainSubstring(`<pre class="error">ValueError: bad</pre>`))
+	})
+
+	It("keep outputs apart from the style and the ids of the page", func() {
+		r, err := Render([]byte(`{"nbformat": 4, "metadata": {}, "cells": [
+  {"cell_type": "code", "execution_count": 1, "metadata": {}, "source": "", "outputs": [
+    {"output_type": "stream", "name": "btn btn-danger", "text": "x"},
+    {"output_type": "display_data", "metadata": {}, "data": {"text/html": "<div id=\"header\"><a id=\"user-content-x\">y</a></div>"}}
+  ]}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		h := string(r)
+		Expect(h).To(ContainSubstring("<pre>x</pre>"))
+		Expect(h).NotTo(ContainSubstring("btn"))
+		Expect(h).To(ContainSubstring(`<div id="user-content-header"><a id="user-content-x">y</a></div>`))
+	})
+
+	It("reject what is not a notebook", func() {
+		_, err := Render([]byte("{"))
+		Expect(err).To(HaveOccurred())
+		_, err = Render([]byte(`{"nbformat": 3, "worksheets": []}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
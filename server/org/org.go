@@ -0,0 +1,218 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org
+
+import (
+	"encoding/json"
+	"fmt"
+	c "github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Org owns gists on behalf of its members, so they outlive the membership of their authors.
+type Org struct {
+	Name string `json:"name"`
+	// Admins manage the organization and its gists, they are members too.
+	Admins  []string `json:"admins"`
+	Members []string `json:"members,omitempty"`
+	// Teams maps team names to their members.
+	Teams map[string][]string `json:"teams,omitempty"`
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Org) IsAdmin(name string) bool {
+	return contains(o.Admins, name)
+}
+
+func (o *Org) IsMember(name string) bool {
+	return o.IsAdmin(name) || contains(o.Members, name)
+}
+
+func (o *Org) InTeam(team, name string) bool {
+	return o.IsMember(name) && contains(o.Teams[team], name)
+}
+
+// Owner returns the value which marks gists as owned by the organization.
+// The prefix keeps organizations apart from users, whose names never contain a colon.
+func (o *Org) Owner() string {
+	return ownerPrefix + o.Name
+}
+
+const ownerPrefix = "org:"
+
+// ParseOwner returns the name of the organization which owns a gist, if it is not a user.
+func ParseOwner(owner string) (string, bool) {
+	if strings.HasPrefix(owner, ownerPrefix) {
+		return owner[len(ownerPrefix):], true
+	}
+	return "", false
+}
+
+// ParseTeam splits a team entry of access lists, which is written as <org>/<team>.
+func ParseTeam(team string) (org, name string, ok bool) {
+	kv := strings.SplitN(team, "/", 2)
+	if len(kv) != 2 || user.ValidName(kv[0]) == false || user.ValidName(kv[1]) == false {
+		return "", "", false
+	}
+	return kv[0], kv[1], true
+}
+
+type Orgs interface {
+	Find(name string) (*Org, error)
+	// Of returns the organizations where name is a member.
+	Of(name string) ([]*Org, error)
+	Save(o *Org) error
+	// Create saves o only if no organization has its name yet.
+	Create(o *Org) error
+}
+
+var OrgNotFound = fmt.Errorf("Organization not found")
+var OrgExists = fmt.Errorf("Organization already exists")
+
+type gotiveOrgs struct {
+	config c.Config
+}
+
+func New(c c.Config) Orgs {
+	if err := os.MkdirAll(c.Orgs, 0700); err != nil {
+		panic(err)
+	}
+	return &gotiveOrgs{config: c}
+}
+
+func (s *gotiveOrgs) path(name string) (string, error) {
+	if user.ValidName(name) == false {
+		return "", fmt.Errorf("Unsupported organization name %s", name)
+	}
+	return filepath.Join(s.config.Orgs, name+".json"), nil
+}
+
+func (s *gotiveOrgs) Find(name string) (*Org, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if osutil.IsExist(p) == false {
+		return nil, OrgNotFound
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	o := &Org{}
+	if err := json.Unmarshal(b, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (s *gotiveOrgs) Of(name string) ([]*Org, error) {
+	files, err := filepath.Glob(filepath.Join(s.config.Orgs, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	orgs := []*Org{}
+	for _, f := range files {
+		o, err := s.Find(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			continue
+		}
+		if o.IsMember(name) {
+			orgs = append(orgs, o)
+		}
+	}
+	return orgs, nil
+}
+
+func (s *gotiveOrgs) Save(o *Org) error {
+	return s.write(o, false)
+}
+
+func (s *gotiveOrgs) Create(o *Org) error {
+	return s.write(o, true)
+}
+
+func (s *gotiveOrgs) write(o *Org, create bool) error {
+	if len(o.Admins) < 1 {
+		return fmt.Errorf("Organization needs at least one admin")
+	}
+	for _, names := range append([][]string{o.Admins, o.Members}, teams(o)...) {
+		for _, n := range names {
+			if user.ValidName(n) == false {
+				return fmt.Errorf("Unsupported user name %s", n)
+			}
+		}
+	}
+	for t := range o.Teams {
+		if user.ValidName(t) == false {
+			return fmt.Errorf("Unsupported team name %s", t)
+		}
+	}
+	p, err := s.path(o.Name)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write a temporary file then rename it, so readers never see a half written file.
+	// For create, it is linked instead, which fails when p exists even if another writer races.
+	f, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(b)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if create == false {
+		return os.Rename(tmp, p)
+	}
+	err = os.Link(tmp, p)
+	if os.IsExist(err) {
+		return OrgExists
+	}
+	return err
+}
+
+func teams(o *Org) [][]string {
+	members := [][]string{}
+	for _, m := range o.Teams {
+		members = append(members, m)
+	}
+	return members
+}
@@ -0,0 +1,111 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/org"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+)
+
+var _ = Describe("Orgs", func() {
+	var (
+		orgs Orgs
+		root string
+	)
+	BeforeEach(func() {
+		c := config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "orgs")
+		Expect(err).To(BeNil())
+		root = p
+		c.Orgs = p
+		orgs = New(c)
+	})
+	AfterEach(func() {
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	It("save and find normally", func() {
+		o := &Org{Name: "acme", Admins: []string{"way"}, Members: []string{"moge"}, Teams: map[string][]string{"ops": {"moge"}}}
+		Expect(orgs.Save(o)).To(BeNil())
+		found, err := orgs.Find("acme")
+		Expect(err).To(BeNil())
+		Expect(found).To(Equal(o))
+
+		_, err = orgs.Find("missing")
+		Expect(err).To(Equal(OrgNotFound))
+	})
+
+	It("create only new organizations", func() {
+		Expect(orgs.Create(&Org{Name: "acme", Admins: []string{"way"}})).To(BeNil())
+		Expect(orgs.Create(&Org{Name: "acme", Admins: []string{"moge"}})).To(Equal(OrgExists))
+		found, err := orgs.Find("acme")
+		Expect(err).To(BeNil())
+		Expect(found.Admins).To(Equal([]string{"way"}))
+		Expect(orgs.Create(&Org{Name: "corp"})).NotTo(BeNil())
+	})
+
+	It("know members and teams", func() {
+		o := &Org{Name: "acme", Admins: []string{"way"}, Members: []string{"moge", "hoge"}, Teams: map[string][]string{"ops": {"moge", "gone"}}}
+		Expect(o.IsAdmin("way")).To(BeTrue())
+		Expect(o.IsAdmin("moge")).To(BeFalse())
+		Expect(o.IsMember("way")).To(BeTrue())
+		Expect(o.IsMember("hoge")).To(BeTrue())
+		Expect(o.IsMember("other")).To(BeFalse())
+		Expect(o.InTeam("ops", "moge")).To(BeTrue())
+		Expect(o.InTeam("ops", "hoge")).To(BeFalse())
+		// leaving the organization leaves its teams too
+		Expect(o.InTeam("ops", "gone")).To(BeFalse())
+	})
+
+	It("list organizations of a member", func() {
+		Expect(orgs.Save(&Org{Name: "acme", Admins: []string{"way"}})).To(BeNil())
+		Expect(orgs.Save(&Org{Name: "corp", Admins: []string{"moge"}, Members: []string{"way"}})).To(BeNil())
+		Expect(orgs.Save(&Org{Name: "other", Admins: []string{"moge"}})).To(BeNil())
+		orgs, err := orgs.Of("way")
+		Expect(err).To(BeNil())
+		Expect(orgs).To(HaveLen(2))
+		Expect(orgs[0].Name).To(Equal("acme"))
+		Expect(orgs[1].Name).To(Equal("corp"))
+	})
+
+	It("reject invalid organizations", func() {
+		Expect(orgs.Save(&Org{Name: "acme"})).NotTo(BeNil())
+		Expect(orgs.Save(&Org{Name: "bad name", Admins: []string{"way"}})).NotTo(BeNil())
+		Expect(orgs.Save(&Org{Name: "acme", Admins: []string{"bad:name"}})).NotTo(BeNil())
+		Expect(orgs.Save(&Org{Name: "acme", Admins: []string{"way"}, Teams: map[string][]string{"bad/team": {}}})).NotTo(BeNil())
+	})
+
+	It("parse owners and teams", func() {
+		o := &Org{Name: "acme"}
+		name, ok := ParseOwner(o.Owner())
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("acme"))
+		_, ok = ParseOwner("way")
+		Expect(ok).To(BeFalse())
+
+		org, team, ok := ParseTeam("acme/ops")
+		Expect(ok).To(BeTrue())
+		Expect(org).To(Equal("acme"))
+		Expect(team).To(Equal("ops"))
+		_, _, ok = ParseTeam("cn=dev,ou=groups")
+		Expect(ok).To(BeFalse())
+	})
+})
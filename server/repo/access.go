@@ -0,0 +1,110 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package repo
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Visibility decides who finds and reads a gist.
+type Visibility string
+
+const (
+	// Public gists are listed and readable by everyone.
+	Public Visibility = "public"
+	// Secret gists are not listed, but everyone who knows the id can read them.
+	Secret Visibility = "secret"
+	// Private gists are readable only by the owner and the readers.
+	Private Visibility = "private"
+)
+
+func ParseVisibility(s string) (Visibility, error) {
+	switch v := Visibility(s); v {
+	case Public, Secret, Private:
+		return v, nil
+	}
+	return "", fmt.Errorf("Unsupported visibility %s", s)
+}
+
+// Visibility of the gist, gists made before the visibility was introduced are secret.
+func (r *gotiveRepo) Visibility() (Visibility, error) {
+	v, err := r.getConfig("gotive.visibility")
+	if err != nil || len(v) < 1 {
+		return Secret, err
+	}
+	return ParseVisibility(v)
+}
+
+func (r *gotiveRepo) ApplyVisibility(v Visibility) error {
+	if _, err := ParseVisibility(string(v)); err != nil {
+		return err
+	}
+	return run(r.config, r.root, []string{"config", "gotive.visibility", string(v)})
+}
+
+// Readers returns who may read the private gist, each is "user:<name>" or "team:<name>".
+func (r *gotiveRepo) Readers() ([]string, error) {
+	return r.getConfigAll("gotive.reader")
+}
+
+func (r *gotiveRepo) ApplyReaders(readers []string) error {
+	return r.setConfigAll("gotive.reader", readers)
+}
+
+// Writers returns the collaborators who may change the gist, in the same form as Readers.
+func (r *gotiveRepo) Writers() ([]string, error) {
+	return r.getConfigAll("gotive.writer")
+}
+
+func (r *gotiveRepo) ApplyWriters(writers []string) error {
+	return r.setConfigAll("gotive.writer", writers)
+}
+
+// getConfigAll reads every value of a multi valued key.
+func (r *gotiveRepo) getConfigAll(key string) ([]string, error) {
+	out, err := output(r.config, r.root, []string{"config", "--get-all", key})
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	values := []string{}
+	for _, s := range strings.Split(string(out), "\n") {
+		if s = strings.TrimSpace(s); 0 < len(s) {
+			values = append(values, s)
+		}
+	}
+	return values, nil
+}
+
+// setConfigAll replaces every value of a multi valued key.
+func (r *gotiveRepo) setConfigAll(key string, values []string) error {
+	if err := run(r.config, r.root, []string{"config", "--unset-all", key}); err != nil {
+		// 5 means there was nothing to unset
+		if ee, ok := err.(*exec.ExitError); ok == false || ee.ExitCode() != 5 {
+			return err
+		}
+	}
+	for _, v := range values {
+		if err := run(r.config, r.root, []string{"config", "--add", key, v}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the well known id of the empty tree, used as the origin of root commits.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+type LineKind int
+
+const (
+	Unchanged LineKind = iota
+	Added
+	Removed
+)
+
+type DiffLine struct {
+	Kind     LineKind
+	Old, New int
+	Text     string
+}
+
+type Hunk struct {
+	Header string
+	Lines  []DiffLine
+}
+
+type FileDiff struct {
+	OldName, NewName string
+	Status           string
+	Binary           bool
+	Hunks            []Hunk
+}
+
+func (f FileDiff) Name() string {
+	if 0 < len(f.NewName) {
+		return f.NewName
+	}
+	return f.OldName
+}
+
+// Diff returns every changed file between from and to.
+// An empty from means the empty tree, so the root commit shows all of its files as added.
+func (r *gotiveRepo) Diff(from, to string) ([]FileDiff, error) {
+	if len(from) < 1 {
+		from = emptyTree
+	} else if err := validRev(from); err != nil {
+		return nil, err
+	}
+	if err := validRev(to); err != nil {
+		return nil, err
+	}
+	out, err := output(r.config, r.root, []string{"-c", "core.quotePath=false", "diff", "--no-color", "--no-ext-diff", "-M", from, to, "--"})
+	if err != nil {
+		return nil, err
+	}
+	return parseDiff(out)
+}
+
+func parseDiff(out []byte) ([]FileDiff, error) {
+	diffs := []FileDiff{}
+	var file *FileDiff
+	var hunk *Hunk
+	oldNo, newNo := 0, 0
+
+	flush := func() {
+		if file != nil {
+			if hunk != nil {
+				file.Hunks = append(file.Hunks, *hunk)
+			}
+			diffs = append(diffs, *file)
+		}
+		file, hunk = nil, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			file = &FileDiff{Status: "modified", Hunks: []Hunk{}}
+			if i := strings.Index(line, " b/"); 0 < i {
+				file.OldName = strings.TrimPrefix(line[len("diff --git "):i], "a/")
+				file.NewName = line[i+len(" b/"):]
+			}
+		case file == nil:
+			return nil, fmt.Errorf("Unsupported diff format %q", line)
+		case hunk == nil && strings.HasPrefix(line, "new file mode"):
+			file.Status = "added"
+		case hunk == nil && strings.HasPrefix(line, "deleted file mode"):
+			file.Status = "deleted"
+		case hunk == nil && strings.HasPrefix(line, "rename from "):
+			file.Status = "renamed"
+			file.OldName = line[len("rename from "):]
+		case hunk == nil && strings.HasPrefix(line, "rename to "):
+			file.NewName = line[len("rename to "):]
+		case hunk == nil && strings.HasPrefix(line, "Binary files "):
+			file.Binary = true
+		case hunk == nil && strings.HasPrefix(line, "--- "):
+			if name := diffName(line, "a/"); 0 < len(name) {
+				file.OldName = name
+			}
+		case hunk == nil && strings.HasPrefix(line, "+++ "):
+			if name := diffName(line, "b/"); 0 < len(name) {
+				file.NewName = name
+			}
+		case strings.HasPrefix(line, "@@ "):
+			if hunk != nil {
+				file.Hunks = append(file.Hunks, *hunk)
+			}
+			var err error
+			if oldNo, newNo, err = parseHunkHeader(line); err != nil {
+				return nil, err
+			}
+			hunk = &Hunk{Header: line, Lines: []DiffLine{}}
+		case hunk == nil:
+			// index, mode and similarity lines
+		case strings.HasPrefix(line, "+"):
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: Added, New: newNo, Text: line[1:]})
+			newNo++
+		case strings.HasPrefix(line, "-"):
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: Removed, Old: oldNo, Text: line[1:]})
+			oldNo++
+		case strings.HasPrefix(line, " "), len(line) < 1:
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: Unchanged, Old: oldNo, New: newNo, Text: strings.TrimPrefix(line, " ")})
+			oldNo++
+			newNo++
+		}
+	}
+	flush()
+
+	for i := range diffs {
+		switch diffs[i].Status {
+		case "added":
+			diffs[i].OldName = ""
+		case "deleted":
+			diffs[i].NewName = ""
+		}
+	}
+	return diffs, scanner.Err()
+}
+
+func diffName(line, prefix string) string {
+	name := strings.TrimSuffix(line[4:], "\t")
+	if name == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+// parseHunkHeader reads the starting line numbers from "@@ -l,s +l,s @@".
+func parseHunkHeader(header string) (int, int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0, fmt.Errorf("Unsupported hunk header %q", header)
+	}
+	start := func(s string) (int, error) {
+		return strconv.Atoi(strings.SplitN(s[1:], ",", 2)[0])
+	}
+	o, err := start(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := start(fields[2])
+	if err != nil {
+		return 0, 0, err
+	}
+	return o, n, nil
+}
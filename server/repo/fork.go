@@ -0,0 +1,108 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package repo
+
+import (
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/osutil"
+	"os"
+	"path/filepath"
+)
+
+// ForkRepo clones repoid into a new repository owned by owner, so the fork keeps every commit of its parent.
+// The clone is made under a name which is no valid id and moved in place once it is owned,
+// so nobody sees the fork without its owner.
+func (r *gotiveRepos) ForkRepo(repoid, owner string) (Repo, error) {
+	src, err := r.LoadRepo(repoid)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < 3; i++ {
+		newid := r.rs.Next(16)
+		newone := filepath.Join(r.config.Repo, newid)
+		if osutil.IsExist(newone) {
+			continue
+		}
+		tmpid := ".fork-" + newid
+		tmp := filepath.Join(r.config.Repo, tmpid)
+		if err := run(r.config, r.config.Repo, []string{"clone", "-q", "--", src.Id(), tmpid}); err != nil {
+			log.Debug(err)
+			osutil.ForceRemoveAll(tmp)
+			continue
+		}
+		fork := &gotiveRepo{id: newid, config: r.config, root: tmp}
+		if err := fork.inherit(src, owner); err != nil {
+			osutil.ForceRemoveAll(tmp)
+			return nil, err
+		}
+		if err := os.Rename(tmp, newone); err != nil {
+			osutil.ForceRemoveAll(tmp)
+			return nil, err
+		}
+		fork.root = newone
+		return fork, nil
+	}
+	return nil, FailToMakeRepo
+}
+
+// Forks returns the ids of the direct forks of repoid.
+func (r *gotiveRepos) Forks(repoid string) ([]string, error) {
+	ids, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	forks := []string{}
+	for _, id := range ids {
+		repo, err := r.LoadRepo(id)
+		if err != nil {
+			continue
+		}
+		if parent, err := repo.Parent(); err == nil && parent == repoid {
+			forks = append(forks, id)
+		}
+	}
+	return forks, nil
+}
+
+func (r *gotiveRepo) inherit(parent Repo, owner string) error {
+	// the origin points to the directory of the parent, which is nobody's business.
+	if err := run(r.config, r.root, []string{"remote", "remove", "origin"}); err != nil {
+		return err
+	}
+	desc, err := parent.Desc()
+	if err != nil {
+		return err
+	}
+	if err := r.ApplyDesc(desc); err != nil {
+		return err
+	}
+	// readers are not copied, a private fork is for its new owner.
+	v, err := parent.Visibility()
+	if err != nil {
+		return err
+	}
+	if err := r.ApplyVisibility(v); err != nil {
+		return err
+	}
+	if err := r.ApplyOwner(owner); err != nil {
+		return err
+	}
+	return run(r.config, r.root, []string{"config", "gotive.parent", parent.Id()})
+}
+
+func (r *gotiveRepo) Parent() (string, error) {
+	return r.getConfig("gotive.parent")
+}
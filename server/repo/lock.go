@@ -0,0 +1,63 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package repo
+
+import (
+	"sync"
+)
+
+// lock serializes the changes of a repository, counted by the holders and the waiters.
+type lock struct {
+	sync.Mutex
+	refs int
+}
+
+var (
+	mutex sync.Mutex
+	locks = map[string]*lock{}
+)
+
+func acquire(root string) *lock {
+	mutex.Lock()
+	l, ok := locks[root]
+	if ok == false {
+		l = &lock{}
+		locks[root] = l
+	}
+	l.refs++
+	mutex.Unlock()
+
+	l.Lock()
+	return l
+}
+
+func release(root string, l *lock) {
+	l.Unlock()
+
+	mutex.Lock()
+	if l.refs--; l.refs < 1 {
+		delete(locks, root)
+	}
+	mutex.Unlock()
+}
+
+// Change runs fn while it holds the lock of this repository,
+// so that staging, committing, resetting and pushes never interleave.
+func (r *gotiveRepo) Change(fn func() error) error {
+	l := acquire(r.root)
+	defer release(r.root, l)
+	return fn()
+}
@@ -0,0 +1,122 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package repo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FileStat struct {
+	Name           string
+	Added, Removed int
+	Binary         bool
+}
+
+type Revision struct {
+	Id, Parent, Author, Email, Message string
+	Date                               time.Time
+	Files                              []FileStat
+}
+
+func (r Revision) ShortId() string {
+	if 7 < len(r.Id) {
+		return r.Id[:7]
+	}
+	return r.Id
+}
+
+const (
+	recordSep = "\x1e"
+	fieldSep  = "\x1f"
+)
+
+// Log returns every commit reachable from HEAD, newest first.
+func (r *gotiveRepo) Log() ([]Revision, error) {
+	if r.hasHead() == false {
+		return []Revision{}, nil
+	}
+	format := "--format=format:" + strings.Join([]string{"%x1e%H", "%P", "%an", "%ae", "%at", "%B", ""}, "%x1f")
+	out, err := output(r.config, r.root, []string{"-c", "core.quotePath=false", "log", "--numstat", "--no-renames", format, "HEAD"})
+	if err != nil {
+		return nil, err
+	}
+	return parseLog(string(out))
+}
+
+func parseLog(out string) ([]Revision, error) {
+	revs := []Revision{}
+	for _, record := range strings.Split(out, recordSep) {
+		if len(strings.TrimSpace(record)) < 1 {
+			continue
+		}
+		fields := strings.SplitN(record, fieldSep, 7)
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("Unsupported log format %q", record)
+		}
+		sec, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		files, err := parseNumstat(fields[6])
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, Revision{
+			Id:      fields[0],
+			Parent:  firstParent(fields[1]),
+			Author:  fields[2],
+			Email:   fields[3],
+			Date:    time.Unix(sec, 0),
+			Message: strings.TrimSpace(fields[5]),
+			Files:   files,
+		})
+	}
+	return revs, nil
+}
+
+func firstParent(parents string) string {
+	if ps := strings.Fields(parents); 0 < len(ps) {
+		return ps[0]
+	}
+	return ""
+}
+
+func parseNumstat(out string) ([]FileStat, error) {
+	files := []FileStat{}
+	for _, line := range strings.Split(out, "\n") {
+		cols := strings.SplitN(line, "\t", 3)
+		if len(cols) < 3 {
+			continue
+		}
+		if cols[0] == "-" && cols[1] == "-" {
+			files = append(files, FileStat{Name: cols[2], Binary: true})
+			continue
+		}
+		added, err := strconv.Atoi(cols[0])
+		if err != nil {
+			return nil, err
+		}
+		removed, err := strconv.Atoi(cols[1])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, FileStat{Name: cols[2], Added: added, Removed: removed})
+	}
+	return files, nil
+}
@@ -0,0 +1,58 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package repo
+
+import (
+	"fmt"
+	"github.com/taichi/gotive/log"
+	"io"
+	"strings"
+)
+
+type PackService string
+
+const (
+	UploadPack  PackService = "git-upload-pack"
+	ReceivePack PackService = "git-receive-pack"
+)
+
+func ParseService(service string) (PackService, error) {
+	switch s := PackService(service); s {
+	case UploadPack, ReceivePack:
+		return s, nil
+	}
+	return "", fmt.Errorf("Unsupported service %s", service)
+}
+
+// Pack runs upload-pack or receive-pack on this repository, wired to in and out.
+// Every repository has a working tree, so pushes update it in place while they hold the lock of the repository.
+func (r *gotiveRepo) Pack(s PackService, in io.Reader, out io.Writer, options ...string) error {
+	args := []string{"-c", "receive.denyCurrentBranch=updateInstead", strings.TrimPrefix(string(s), "git-")}
+	args = append(append(args, options...), r.root)
+
+	run := func() error {
+		return pipe(r.config, r.root, args, in, out)
+	}
+	if s == ReceivePack {
+		pack := run
+		run = func() error { return r.Change(pack) }
+	}
+	if err := run(); err != nil {
+		log.Errorf("%s %v", s, err)
+		return err
+	}
+	return nil
+}
@@ -22,10 +22,13 @@ import (
 	"github.com/taichi/gotive/log"
 	"github.com/taichi/osutil"
 	"github.com/taichi/rand"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -37,6 +40,10 @@ type gotiveRepos struct {
 type RepoMaker interface {
 	MakeRepo() (Repo, error)
 	LoadRepo(repoid string) (Repo, error)
+	ForkRepo(repoid, owner string) (Repo, error)
+	Forks(repoid string) ([]string, error)
+	RemoveRepo(repoid string) error
+	List() ([]string, error)
 }
 
 func New(c c.Config) RepoMaker {
@@ -60,8 +67,30 @@ type Repo interface {
 	Id() string
 	Desc() (string, error)
 	ApplyDesc(desc string) error
+	Owner() (string, error)
+	ApplyOwner(name string) error
+	Visibility() (Visibility, error)
+	ApplyVisibility(v Visibility) error
+	Readers() ([]string, error)
+	ApplyReaders(readers []string) error
+	Writers() ([]string, error)
+	ApplyWriters(writers []string) error
+	Parent() (string, error)
 	Add(name, content string) error
+	Update(name, content string) error
+	Remove(name string) error
+	Rename(from, to string) error
+	Staged() (bool, error)
 	Commit(name, email string) error
+	Reset() error
+	Change(fn func() error) error
+	Log() ([]Revision, error)
+	Resolve(rev string) (string, error)
+	Files(rev string) ([]string, error)
+	Show(rev, path string) ([]byte, error)
+	Diff(from, to string) ([]FileDiff, error)
+	Pack(s PackService, in io.Reader, out io.Writer, options ...string) error
+	Archive(rev, format, prefix string, out io.Writer) error
 	Walk(fn filepath.WalkFunc) error
 	ReadFile(path string) ([]byte, error)
 }
@@ -91,7 +120,12 @@ func (r *gotiveRepos) MakeRepo() (Repo, error) {
 	return nil, FailToMakeRepo
 }
 
+var validId = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
 func (r *gotiveRepos) LoadRepo(repoid string) (Repo, error) {
+	if validId.MatchString(repoid) == false {
+		return nil, fmt.Errorf("Unsupported repository id %s", repoid)
+	}
 	repo := filepath.Join(r.config.Repo, repoid)
 	if _, err := os.Lstat(repo); err != nil {
 		return nil, err
@@ -99,6 +133,35 @@ func (r *gotiveRepos) LoadRepo(repoid string) (Repo, error) {
 	return &gotiveRepo{id: repoid, config: r.config, root: repo}, nil
 }
 
+func (r *gotiveRepos) RemoveRepo(repoid string) error {
+	if _, err := r.LoadRepo(repoid); err != nil {
+		return err
+	}
+	return osutil.ForceRemoveAll(filepath.Join(r.config.Repo, repoid))
+}
+
+// List returns every repository id, the most recently modified first.
+func (r *gotiveRepos) List() ([]string, error) {
+	infos, err := ioutil.ReadDir(r.config.Repo)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byModTime(infos))
+	ids := []string{}
+	for _, info := range infos {
+		if info.IsDir() && validId.MatchString(info.Name()) {
+			ids = append(ids, info.Name())
+		}
+	}
+	return ids, nil
+}
+
+type byModTime []os.FileInfo
+
+func (b byModTime) Len() int           { return len(b) }
+func (b byModTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byModTime) Less(i, j int) bool { return b[j].ModTime().Before(b[i].ModTime()) }
+
 func (r *gotiveRepo) Id() string {
 	return r.id
 }
@@ -116,6 +179,26 @@ func (r *gotiveRepo) ApplyDesc(desc string) error {
 	return ioutil.WriteFile(r.DescPath(), []byte(desc), 0)
 }
 
+func (r *gotiveRepo) Owner() (string, error) {
+	return r.getConfig("gotive.owner")
+}
+
+func (r *gotiveRepo) ApplyOwner(name string) error {
+	return run(r.config, r.root, []string{"config", "gotive.owner", name})
+}
+
+// getConfig reads a single value from the repository config, a missing key is an empty value.
+func (r *gotiveRepo) getConfig(key string) (string, error) {
+	out, err := output(r.config, r.root, []string{"config", "--get", key})
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 func run(c c.Config, root string, options []string, env ...map[string]string) error {
 	cmd := exec.Command(c.Git, options...)
 	cmd.Dir = root
@@ -137,6 +220,36 @@ func run(c c.Config, root string, options []string, env ...map[string]string) er
 	return cmd.Run() // TODO timeout
 }
 
+func output(c c.Config, root string, options []string, env ...map[string]string) ([]byte, error) {
+	cmd := exec.Command(c.Git, options...)
+	cmd.Dir = root
+	cmd.Env = mergeEnv(env...)
+
+	var err bytes.Buffer
+	cmd.Stderr = &err
+	out, e := cmd.Output()
+	if e != nil && log.IsDebugEnabled() {
+		log.Debug(err.String())
+	}
+	return out, e // TODO timeout
+}
+
+// pipe runs git with in and out as its standard streams, stderr is folded into the error.
+func pipe(c c.Config, root string, options []string, in io.Reader, out io.Writer) error {
+	cmd := exec.Command(c.Git, options...)
+	cmd.Dir = root
+	cmd.Env = mergeEnv()
+	cmd.Stdin = in
+	cmd.Stdout = out
+
+	var err bytes.Buffer
+	cmd.Stderr = &err
+	if e := cmd.Run(); e != nil {
+		return fmt.Errorf("%v %s", e, strings.TrimSpace(err.String()))
+	}
+	return nil
+}
+
 func mergeEnv(newmaps ...map[string]string) []string {
 	out := os.Environ()
 	for _, m := range newmaps {
@@ -170,21 +283,43 @@ func find(target []string, fn Matcher) (found bool, index int) {
 	return false, -1
 }
 
-func (r *gotiveRepo) Add(name, content string) error {
+func (r *gotiveRepo) resolve(name string) (string, error) {
 	p := filepath.Join(r.root, name)
+	if p == r.root || osutil.Contains(r.root, p) == false || isGit(name) {
+		return "", fmt.Errorf("Unsupported path %s", name)
+	}
+	return p, nil
+}
 
-	if osutil.Contains(r.root, p) == false {
-		return fmt.Errorf("Unsupported path %s", name)
+func (r *gotiveRepo) Add(name, content string) error {
+	p, err := r.resolve(name)
+	if err != nil {
+		return err
 	}
 
 	if osutil.IsExist(p) {
-		return fmt.Errorf("Already Exists %s", name) // override? merge?
+		return fmt.Errorf("Already Exists %s", name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
 	}
+	return r.write(p, content)
+}
 
-	if err := os.MkdirAll(filepath.Dir(p), 0644); err != nil {
+func (r *gotiveRepo) Update(name, content string) error {
+	p, err := r.resolve(name)
+	if err != nil {
 		return err
 	}
 
+	if osutil.IsExist(p) == false {
+		return fmt.Errorf("Not Exists %s", name)
+	}
+	return r.write(p, content)
+}
+
+func (r *gotiveRepo) write(p, content string) error {
 	if err := ioutil.WriteFile(p, []byte(content), 0644 /*-rw-r--r--*/); err != nil {
 		return err
 	}
@@ -195,10 +330,87 @@ func (r *gotiveRepo) Add(name, content string) error {
 	}
 }
 
+func (r *gotiveRepo) Remove(name string) error {
+	p, err := r.resolve(name)
+	if err != nil {
+		return err
+	}
+	if osutil.IsExist(p) == false {
+		return fmt.Errorf("Not Exists %s", name)
+	}
+	rel, err := filepath.Rel(r.root, p)
+	if err != nil {
+		return err
+	}
+	return run(r.config, r.root, []string{"rm", "-q", "--", rel})
+}
+
+func (r *gotiveRepo) Rename(from, to string) error {
+	src, err := r.resolve(from)
+	if err != nil {
+		return err
+	}
+	dest, err := r.resolve(to)
+	if err != nil {
+		return err
+	}
+	if osutil.IsExist(src) == false {
+		return fmt.Errorf("Not Exists %s", from)
+	}
+	if osutil.IsExist(dest) {
+		return fmt.Errorf("Already Exists %s", to)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	srel, err := filepath.Rel(r.root, src)
+	if err != nil {
+		return err
+	}
+	drel, err := filepath.Rel(r.root, dest)
+	if err != nil {
+		return err
+	}
+	return run(r.config, r.root, []string{"mv", "--", srel, drel})
+}
+
+// Staged reports whether the index has any changes to commit.
+func (r *gotiveRepo) Staged() (bool, error) {
+	if r.hasHead() == false {
+		// no commits yet, so anything in the index is a change.
+		out, err := output(r.config, r.root, []string{"ls-files"})
+		return 0 < len(out), err
+	}
+	err := run(r.config, r.root, []string{"diff", "--cached", "--quiet"})
+	if err == nil {
+		return false, nil
+	}
+	if ee, ok := err.(*exec.ExitError); ok && ee.Success() == false {
+		return true, nil
+	}
+	return false, err
+}
+
 func (r *gotiveRepo) Commit(name, email string) error {
 	return run(r.config, r.root, []string{"commit", "--allow-empty-message", "-m", ""}, r.makeEnv(name, email))
 }
 
+// Reset discards the staged and the working tree changes, back to the last commit.
+func (r *gotiveRepo) Reset() error {
+	if r.hasHead() {
+		if err := run(r.config, r.root, []string{"reset", "-q", "--hard", "HEAD"}); err != nil {
+			return err
+		}
+	} else if err := run(r.config, r.root, []string{"rm", "-r", "-q", "--cached", "--ignore-unmatch", "."}); err != nil {
+		return err
+	}
+	return run(r.config, r.root, []string{"clean", "-f", "-d", "-q"})
+}
+
+func (r *gotiveRepo) hasHead() bool {
+	return run(r.config, r.root, []string{"rev-parse", "--verify", "-q", "HEAD"}) == nil
+}
+
 func (r *gotiveRepo) makeEnv(name, email string) map[string]string {
 	env := map[string]string{}
 
@@ -231,14 +443,20 @@ func (r *gotiveRepo) Walk(fn filepath.WalkFunc) error {
 	})
 }
 
+// isGit reports whether path has the .git directory as one of its elements, ".gitignore" does not.
 func isGit(path string) bool {
-	return -1 < strings.Index(path, ".git")
+	for _, e := range strings.Split(filepath.ToSlash(filepath.Clean(path)), "/") {
+		if e == ".git" {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *gotiveRepo) ReadFile(path string) ([]byte, error) {
 	p := filepath.Join(r.root, path)
 
-	if osutil.Contains(r.root, p) == false || isGit(p) {
+	if osutil.Contains(r.root, p) == false || isGit(path) {
 		return nil, fmt.Errorf("Unsupported path %s", p)
 	}
 
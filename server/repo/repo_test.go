@@ -17,6 +17,8 @@ package repo_test
 
 import (
 	. "."
+	"archive/tar"
+	"bytes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/taichi/gotive/config"
@@ -26,6 +28,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var _ = Describe("RepoMaker", func() {
@@ -99,5 +102,317 @@ var _ = Describe("RepoMaker", func() {
 			Expect(err).To(BeNil())
 			Expect(r.Commit("way", "wayway@example.com")).To(BeNil())
 		})
+
+		It("update, rename and remove contents normally", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add("hoge.txt", "hogehoge")).To(BeNil())
+			Expect(r.Add("moge.txt", "mogemoge")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			staged, err := r.Staged()
+			Expect(err).To(BeNil())
+			Expect(staged).To(BeFalse())
+
+			Expect(r.Update("hoge.txt", "fugafuga")).To(BeNil())
+			Expect(r.Rename("hoge.txt", "piyo/hoge.txt")).To(BeNil())
+			Expect(r.Remove("moge.txt")).To(BeNil())
+
+			staged, err = r.Staged()
+			Expect(err).To(BeNil())
+			Expect(staged).To(BeTrue())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			read, re := r.ReadFile("piyo/hoge.txt")
+			Expect(re).To(BeNil())
+			Expect(string(read)).To(Equal("fugafuga"))
+			Expect(osutil.IsExist(filepath.Join(c.Repo, r.Id(), "hoge.txt"))).To(BeFalse())
+			Expect(osutil.IsExist(filepath.Join(c.Repo, r.Id(), "moge.txt"))).To(BeFalse())
+		})
+
+		It("reset staged and working tree changes", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add("hoge.txt", "hogehoge")).To(BeNil())
+			Expect(r.Add(".gitignore", "*.log\n")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			Expect(r.Update("hoge.txt", "fugafuga")).To(BeNil())
+			Expect(r.Add("moge/moge.txt", "mogemoge")).To(BeNil())
+			Expect(r.Rename(".gitignore", "ignore")).To(BeNil())
+			Expect(r.Reset()).To(BeNil())
+
+			staged, err := r.Staged()
+			Expect(err).To(BeNil())
+			Expect(staged).To(BeFalse())
+			read, re := r.ReadFile("hoge.txt")
+			Expect(re).To(BeNil())
+			Expect(string(read)).To(Equal("hogehoge"))
+			Expect(osutil.IsExist(filepath.Join(c.Repo, r.Id(), "moge"))).To(BeFalse())
+			Expect(osutil.IsExist(filepath.Join(c.Repo, r.Id(), ".gitignore"))).To(BeTrue())
+		})
+
+		It("serialize changes of the same repository", func() {
+			r := repoOk(rm.MakeRepo())
+			other := repoOk(rm.LoadRepo(r.Id()))
+			entered, done := make(chan bool), make(chan bool)
+			go func() {
+				defer GinkgoRecover()
+				Expect(r.Change(func() error {
+					entered <- true
+					<-done
+					return nil
+				})).To(BeNil())
+			}()
+			<-entered
+
+			changed := make(chan bool, 1)
+			go func() {
+				other.Change(func() error {
+					changed <- true
+					return nil
+				})
+			}()
+			select {
+			case <-changed:
+				Fail("changed while the other change holds the lock")
+			case <-time.After(100 * time.Millisecond):
+			}
+			close(done)
+			select {
+			case <-changed:
+			case <-time.After(5 * time.Second):
+				Fail("never changed after the lock is released")
+			}
+		})
+
+		It("reject paths in the git directory", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add(".git/config", "x")).NotTo(BeNil())
+			Expect(r.Add("a/../.git/hooks/x", "x")).NotTo(BeNil())
+			Expect(r.Add("sub/.git", "x")).NotTo(BeNil())
+			Expect(r.Add(".github/workflow.yml", "x")).To(BeNil())
+			_, err := r.ReadFile(".git/config")
+			Expect(err).NotTo(BeNil())
+		})
+
+		It("log revisions normally", func() {
+			r := repoOk(rm.MakeRepo())
+			revs, err := r.Log()
+			Expect(err).To(BeNil())
+			Expect(revs).To(BeEmpty())
+
+			Expect(r.Add("hoge.txt", "hoge\nhoge\n")).To(BeNil())
+			Expect(r.Commit("way", "wayway@example.com")).To(BeNil())
+			Expect(r.Update("hoge.txt", "hoge\nmoge\nmoge\n")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			revs, err = r.Log()
+			Expect(err).To(BeNil())
+			Expect(revs).To(HaveLen(2))
+			Expect(revs[0].Author).To(Equal(c.Commit.Name))
+			Expect(revs[0].Files).To(Equal([]FileStat{{Name: "hoge.txt", Added: 2, Removed: 1}}))
+			Expect(revs[1].Author).To(Equal("way"))
+			Expect(revs[1].Email).To(Equal("wayway@example.com"))
+			Expect(revs[1].Files).To(Equal([]FileStat{{Name: "hoge.txt", Added: 2}}))
+		})
+
+		It("log non-ascii file names as they are", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add("日本語.txt", "hoge\n")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			revs, err := r.Log()
+			Expect(err).To(BeNil())
+			Expect(revs).To(HaveLen(1))
+			Expect(revs[0].Files).To(Equal([]FileStat{{Name: "日本語.txt", Added: 1}}))
+		})
+
+		It("read contents at any revision", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add("hoge.txt", "hogehoge")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+			first, err := r.Resolve(Head)
+			Expect(err).To(BeNil())
+
+			Expect(r.Add("moge.txt", "mogemoge")).To(BeNil())
+			Expect(r.Update("hoge.txt", "fugafuga")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			files, err := r.Files(first[:7])
+			Expect(err).To(BeNil())
+			Expect(files).To(Equal([]string{"hoge.txt"}))
+			b, err := r.Show(first, "hoge.txt")
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal("hogehoge"))
+
+			files, err = r.Files(Head)
+			Expect(err).To(BeNil())
+			Expect(files).To(Equal([]string{"hoge.txt", "moge.txt"}))
+
+			_, err = r.Resolve("--all")
+			Expect(err).NotTo(BeNil())
+			_, err = r.Resolve("0000000")
+			Expect(err).NotTo(BeNil())
+		})
+
+		It("diff revisions normally", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add("hoge.txt", "a\nb\nc\n")).To(BeNil())
+			Expect(r.Add("moge.txt", "moge\n")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+			from, _ := r.Resolve(Head)
+
+			Expect(r.Update("hoge.txt", "a\nB\nc\n")).To(BeNil())
+			Expect(r.Rename("moge.txt", "fuga.txt")).To(BeNil())
+			Expect(r.Add("new file.txt", "new\n")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+			to, _ := r.Resolve(Head)
+
+			diffs, err := r.Diff(from, to)
+			Expect(err).To(BeNil())
+			Expect(diffs).To(HaveLen(3))
+
+			Expect(diffs[0].OldName).To(Equal("moge.txt"))
+			Expect(diffs[0].NewName).To(Equal("fuga.txt"))
+			Expect(diffs[0].Status).To(Equal("renamed"))
+
+			Expect(diffs[1].Name()).To(Equal("hoge.txt"))
+			Expect(diffs[1].Status).To(Equal("modified"))
+			Expect(diffs[1].Hunks).To(HaveLen(1))
+			Expect(diffs[1].Hunks[0].Lines).To(Equal([]DiffLine{
+				{Kind: Unchanged, Old: 1, New: 1, Text: "a"},
+				{Kind: Removed, Old: 2, Text: "b"},
+				{Kind: Added, New: 2, Text: "B"},
+				{Kind: Unchanged, Old: 3, New: 3, Text: "c"},
+			}))
+
+			Expect(diffs[2].OldName).To(Equal(""))
+			Expect(diffs[2].NewName).To(Equal("new file.txt"))
+			Expect(diffs[2].Status).To(Equal("added"))
+
+			all, err := r.Diff("", from)
+			Expect(err).To(BeNil())
+			Expect(all).To(HaveLen(2))
+		})
+
+		It("list and remove repositories normally", func() {
+			r1 := repoOk(rm.MakeRepo())
+			r2 := repoOk(rm.MakeRepo())
+			ids, err := rm.List()
+			Expect(err).To(BeNil())
+			Expect(ids).To(HaveLen(2))
+			Expect(ids).To(ContainElement(r1.Id()))
+			Expect(ids).To(ContainElement(r2.Id()))
+
+			Expect(rm.RemoveRepo(r1.Id())).To(BeNil())
+			ids, err = rm.List()
+			Expect(err).To(BeNil())
+			Expect(ids).To(Equal([]string{r2.Id()}))
+			_, err = rm.LoadRepo(r1.Id())
+			Expect(err).NotTo(BeNil())
+		})
+
+		It("keep visibility, readers and writers normally", func() {
+			r := repoOk(rm.MakeRepo())
+			v, err := r.Visibility()
+			Expect(err).To(BeNil())
+			Expect(v).To(Equal(Secret))
+
+			Expect(r.ApplyVisibility(Private)).To(BeNil())
+			v, err = r.Visibility()
+			Expect(err).To(BeNil())
+			Expect(v).To(Equal(Private))
+			Expect(r.ApplyVisibility("hidden")).NotTo(BeNil())
+
+			readers, err := r.Readers()
+			Expect(err).To(BeNil())
+			Expect(readers).To(BeEmpty())
+			Expect(r.ApplyReaders([]string{"user:way", "team:cn=dev,ou=groups"})).To(BeNil())
+			readers, err = r.Readers()
+			Expect(err).To(BeNil())
+			Expect(readers).To(Equal([]string{"user:way", "team:cn=dev,ou=groups"}))
+			Expect(r.ApplyReaders([]string{"user:moge"})).To(BeNil())
+			readers, err = r.Readers()
+			Expect(err).To(BeNil())
+			Expect(readers).To(Equal([]string{"user:moge"}))
+
+			Expect(r.ApplyWriters([]string{"user:hoge"})).To(BeNil())
+			writers, err := r.Writers()
+			Expect(err).To(BeNil())
+			Expect(writers).To(Equal([]string{"user:hoge"}))
+			readers, err = r.Readers()
+			Expect(err).To(BeNil())
+			Expect(readers).To(Equal([]string{"user:moge"}))
+		})
+
+		It("fork with full history", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.ApplyDesc("hoge")).To(BeNil())
+			Expect(r.ApplyVisibility(Public)).To(BeNil())
+			Expect(r.Add("hoge.txt", "hogehoge")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+			Expect(r.Update("hoge.txt", "mogemoge")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			f := repoOk(rm.ForkRepo(r.Id(), "way"))
+			Expect(f.Id()).NotTo(Equal(r.Id()))
+			owner, err := f.Owner()
+			Expect(err).To(BeNil())
+			Expect(owner).To(Equal("way"))
+			ids, err := rm.List()
+			Expect(err).To(BeNil())
+			Expect(ids).To(HaveLen(2))
+			Expect(ids).To(ContainElement(f.Id()))
+			parent, err := f.Parent()
+			Expect(err).To(BeNil())
+			Expect(parent).To(Equal(r.Id()))
+			desc, err := f.Desc()
+			Expect(err).To(BeNil())
+			Expect(desc).To(Equal("hoge"))
+			v, err := f.Visibility()
+			Expect(err).To(BeNil())
+			Expect(v).To(Equal(Public))
+
+			orig, _ := r.Log()
+			forked, err := f.Log()
+			Expect(err).To(BeNil())
+			Expect(forked).To(Equal(orig))
+
+			Expect(f.Update("hoge.txt", "fugafuga")).To(BeNil())
+			Expect(f.Commit("", "")).To(BeNil())
+			b, _ := r.ReadFile("hoge.txt")
+			Expect(string(b)).To(Equal("mogemoge"))
+
+			forks, err := rm.Forks(r.Id())
+			Expect(err).To(BeNil())
+			Expect(forks).To(Equal([]string{f.Id()}))
+		})
+
+		It("archive normally", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add("hoge/moge.txt", "hogehoge")).To(BeNil())
+			Expect(r.Commit("", "")).To(BeNil())
+
+			var buf bytes.Buffer
+			Expect(r.Archive(Head, "tar", "prefix/", &buf)).To(BeNil())
+			tr := tar.NewReader(&buf)
+			names := []string{}
+			for h, err := tr.Next(); err == nil; h, err = tr.Next() {
+				names = append(names, h.Name)
+			}
+			Expect(names).To(ContainElement("prefix/hoge/moge.txt"))
+
+			Expect(r.Archive(Head, "rar", "", &buf)).NotTo(BeNil())
+		})
+
+		It("should not touch outside of repository", func() {
+			r := repoOk(rm.MakeRepo())
+			Expect(r.Add("../hoge.txt", "hogehoge")).NotTo(BeNil())
+			Expect(r.Add(".git/hoge", "hogehoge")).NotTo(BeNil())
+			Expect(r.Update("missing.txt", "hogehoge")).NotTo(BeNil())
+			Expect(r.Remove("missing.txt")).NotTo(BeNil())
+
+			_, err := rm.LoadRepo("..")
+			Expect(err).NotTo(BeNil())
+		})
 	})
 })
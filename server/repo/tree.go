@@ -0,0 +1,86 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package repo
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const Head = "HEAD"
+
+func validRev(rev string) error {
+	if len(rev) < 1 || strings.HasPrefix(rev, "-") || strings.ContainsAny(rev, ": \t\n") {
+		return fmt.Errorf("Unsupported revision %s", rev)
+	}
+	return nil
+}
+
+// Resolve returns the full commit id which rev points to.
+func (r *gotiveRepo) Resolve(rev string) (string, error) {
+	if err := validRev(rev); err != nil {
+		return "", err
+	}
+	out, err := output(r.config, r.root, []string{"rev-parse", "--verify", "-q", rev + "^{commit}"})
+	if err != nil {
+		return "", fmt.Errorf("Unknown revision %s", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Files returns every file path in the tree of rev.
+func (r *gotiveRepo) Files(rev string) ([]string, error) {
+	if err := validRev(rev); err != nil {
+		return nil, err
+	}
+	if rev == Head && r.hasHead() == false {
+		return []string{}, nil
+	}
+	out, err := output(r.config, r.root, []string{"ls-tree", "-r", "-z", "--name-only", rev})
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if 0 < len(name) {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// Show returns the content of path as it was at rev.
+func (r *gotiveRepo) Show(rev, path string) ([]byte, error) {
+	if err := validRev(rev); err != nil {
+		return nil, err
+	}
+	if len(path) < 1 {
+		return nil, fmt.Errorf("Unsupported path %s", path)
+	}
+	return output(r.config, r.root, []string{"cat-file", "blob", rev + ":" + path})
+}
+
+// Archive writes the tree of rev to out as zip or tar, every entry is placed under prefix.
+func (r *gotiveRepo) Archive(rev, format, prefix string, out io.Writer) error {
+	if err := validRev(rev); err != nil {
+		return err
+	}
+	if format != "zip" && format != "tar" {
+		return fmt.Errorf("Unsupported format %s", format)
+	}
+	return pipe(r.config, r.root, []string{"archive", "--format=" + format, "--prefix=" + prefix, rev}, nil, out)
+}
@@ -16,12 +16,22 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
 	"github.com/codegangsta/martini"
 	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
 	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
 	"github.com/taichi/gotive/server/handler"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/sshd"
+	"github.com/taichi/gotive/server/sso"
+	"html/template"
 	"net/http"
+	"strings"
 )
 
 func classic() *martini.ClassicMartini {
@@ -34,6 +44,7 @@ func classic() *martini.ClassicMartini {
 		Directory:  "server/template",
 		Layout:     "layout",
 		Extensions: []string{".tmpl", ".html"},
+		Funcs:      []template.FuncMap{handler.Funcs},
 	}))
 	m.Action(r.Handle)
 	return &martini.ClassicMartini{m, r}
@@ -42,6 +53,59 @@ func classic() *martini.ClassicMartini {
 func Start(c config.Config) error {
 	m := classic()
 	m.Map(c)
+	store := sessions.NewCookieStore(secret(c))
+	store.Options(sessions.Options{Path: "/", HttpOnly: true, Secure: strings.HasPrefix(c.URL, "https://")})
+	m.Use(sessions.Sessions("gotive", store))
+	m.Use(handler.Authenticate)
+	provider, err := sso.New(context.Background(), c)
+	if err != nil {
+		return err
+	}
+	m.Map(provider)
+	idx, err := openIndex(c)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+	m.Map(idx)
 	handler.AddHandlers(m)
+	if 0 < c.SshPort {
+		go func() {
+			if err := sshd.Start(c, idx); err != nil {
+				log.Error(err)
+			}
+		}()
+	}
 	return http.ListenAndServe(fmt.Sprintf(":%d", c.Port), m)
 }
+
+// openIndex opens the index of gists, which is built from the repositories at first start and after upgrades.
+func openIndex(c config.Config) (*index.Index, error) {
+	idx, err := index.Open(c)
+	if err != nil {
+		return nil, err
+	}
+	if outdated, err := idx.Outdated(); err != nil || outdated == false {
+		return idx, err
+	}
+	log.Info("building the index of gists")
+	if err := idx.Reindex(repo.New(c), false, nil); err != nil {
+		idx.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// secret returns the key to sign session cookies. Without configuration,
+// a random key is made, so logins do not survive a restart.
+func secret(c config.Config) []byte {
+	if 0 < len(c.Secret) {
+		return []byte(c.Secret)
+	}
+	log.Warn("secret is not configured, sessions are lost on restart")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
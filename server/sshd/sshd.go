@@ -0,0 +1,200 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sshd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/gotive/server/acl"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Start serves git over ssh on c.SshPort until the listener fails.
+func Start(c config.Config, idx *index.Index) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", c.SshPort))
+	if err != nil {
+		return err
+	}
+	return Serve(listener, c, idx)
+}
+
+// Serve serves git over ssh on the connections which listener accepts.
+func Serve(listener net.Listener, c config.Config, idx *index.Index) error {
+	signer, err := hostKey(c.HostKey)
+	if err != nil {
+		return err
+	}
+	users := user.New(c)
+	sc := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			u, err := users.FindByKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("Unknown public key for %s", conn.User())
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"user": u.Name}}, nil
+		},
+	}
+	sc.AddHostKey(signer)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serve(c, idx, sc, conn)
+	}
+}
+
+// hostKey loads the host key, generating one at first start.
+func hostKey(path string) (ssh.Signer, error) {
+	if osutil.IsExist(path) == false {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			return nil, err
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(b)
+}
+
+func serve(c config.Config, idx *index.Index, sc *ssh.ServerConfig, conn net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, sc)
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	name := sconn.Permissions.Extensions["user"]
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			log.Debug(err)
+			continue
+		}
+		go session(c, idx, name, ch, requests)
+	}
+}
+
+func session(c config.Config, idx *index.Index, name string, ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				return
+			}
+			req.Reply(true, nil)
+			status := execute(c, idx, name, payload.Command, ch)
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+var command = regexp.MustCompile(`^(git-upload-pack|git-receive-pack|git upload-pack|git receive-pack) '?/?([a-zA-Z0-9]+)(\.git)?/?'?$`)
+
+// execute runs a git command requested by the client and returns its exit status.
+func execute(c config.Config, idx *index.Index, name, cmd string, ch ssh.Channel) uint32 {
+	m := command.FindStringSubmatch(strings.TrimSpace(cmd))
+	if m == nil {
+		fmt.Fprintf(ch.Stderr(), "Unsupported command %s\n", cmd)
+		return 1
+	}
+	s, err := repo.ParseService(strings.Replace(m[1], " ", "-", 1))
+	if err != nil {
+		fmt.Fprintln(ch.Stderr(), err)
+		return 1
+	}
+	u, err := user.New(c).Find(name)
+	if err != nil {
+		fmt.Fprintln(ch.Stderr(), err)
+		return 1
+	}
+	a := acl.New(c)
+	r, err := a.Load(u, m[2])
+	if err != nil {
+		fmt.Fprintf(ch.Stderr(), "Repository not found %s\n", m[2])
+		return 1
+	}
+
+	if s == repo.ReceivePack {
+		if ok, err := a.Writable(u, r); err != nil || ok == false {
+			fmt.Fprintf(ch.Stderr(), "Permission denied to %s\n", name)
+			return 1
+		}
+		if err := idx.Mark(r.Id()); err != nil {
+			log.Error(err)
+			return 1
+		}
+	}
+
+	// hand git a real pipe, so it never waits for the client to close its side after exit.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer pr.Close()
+	go func() {
+		io.Copy(pw, ch)
+		pw.Close()
+	}()
+
+	if err := r.Pack(s, pr, ch); err != nil {
+		log.Debug(err)
+		return 1
+	}
+	if s == repo.ReceivePack {
+		if err := idx.Sync(r); err != nil {
+			log.Errorf("fail to index %s: %v", r.Id(), err)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,157 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sshd_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/index"
+	"github.com/taichi/gotive/server/repo"
+	. "github.com/taichi/gotive/server/sshd"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Describe("Sshd", func() {
+	var (
+		c        config.Config
+		idx      *index.Index
+		listener net.Listener
+		root     string
+		gist     repo.Repo
+		way      ssh.Signer
+		other    ssh.Signer
+	)
+
+	newSigner := func() ssh.Signer {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).To(BeNil())
+		s, err := ssh.NewSignerFromKey(key)
+		Expect(err).To(BeNil())
+		return s
+	}
+
+	register := func(name string, s ssh.Signer) {
+		u := &user.User{Name: name}
+		Expect(u.AddKey(ssh.MarshalAuthorizedKey(s.PublicKey()))).To(BeNil())
+		Expect(user.New(c).Save(u)).To(BeNil())
+	}
+
+	BeforeEach(func() {
+		c = config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "sshd")
+		Expect(err).To(BeNil())
+		root = p
+		c.Repo = filepath.Join(p, "repo")
+		c.Users = filepath.Join(p, "users")
+		c.Index = filepath.Join(p, "index.db")
+		c.HostKey = filepath.Join(p, "host_key")
+		idx, err = index.Open(c)
+		Expect(err).To(BeNil())
+
+		way, other = newSigner(), newSigner()
+		register("way", way)
+		register("other", other)
+
+		gist, err = repo.New(c).MakeRepo()
+		Expect(err).To(BeNil())
+		Expect(gist.Add("hoge.txt", "hogehoge")).To(BeNil())
+		Expect(gist.ApplyOwner("way")).To(BeNil())
+		Expect(gist.Commit("way", "way@example.com")).To(BeNil())
+
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		go Serve(listener, c, idx)
+	})
+	AfterEach(func() {
+		listener.Close()
+		Expect(idx.Close()).To(BeNil())
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	dial := func(s ssh.Signer) (*ssh.Client, error) {
+		return ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+			User:            "git",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(s)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+	}
+
+	// run executes cmd and returns its output and exit status, the client ends the
+	// conversation with a flush packet right after the refs are advertised.
+	run := func(s ssh.Signer, cmd string) (string, string, int) {
+		client, err := dial(s)
+		Expect(err).To(BeNil())
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).To(BeNil())
+		defer session.Close()
+		var out, stderr bytes.Buffer
+		session.Stdin = strings.NewReader("0000")
+		session.Stdout, session.Stderr = &out, &stderr
+		if err := session.Run(cmd); err != nil {
+			ee, ok := err.(*ssh.ExitError)
+			Expect(ok).To(BeTrue())
+			return out.String(), stderr.String(), ee.ExitStatus()
+		}
+		return out.String(), stderr.String(), 0
+	}
+
+	It("reject unknown keys", func() {
+		_, err := dial(newSigner())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("advertise refs to readers", func() {
+		out, _, status := run(other, "git-upload-pack '/"+gist.Id()+".git'")
+		Expect(status).To(Equal(0))
+		Expect(out).To(ContainSubstring("refs/heads/"))
+	})
+
+	It("let only writers push", func() {
+		out, _, status := run(way, "git receive-pack '"+gist.Id()+".git'")
+		Expect(status).To(Equal(0))
+		Expect(out).To(ContainSubstring("report-status"))
+
+		_, stderr, status := run(other, "git-receive-pack '"+gist.Id()+".git'")
+		Expect(status).To(Equal(1))
+		Expect(stderr).To(ContainSubstring("Permission denied to other"))
+	})
+
+	It("reject other commands and unknown gists", func() {
+		_, stderr, status := run(way, "sh -c id")
+		Expect(status).To(Equal(1))
+		Expect(stderr).To(ContainSubstring("Unsupported command"))
+
+		_, stderr, status = run(way, "git-upload-pack '../"+gist.Id()+".git'")
+		Expect(status).To(Equal(1))
+		Expect(stderr).To(ContainSubstring("Unsupported command"))
+
+		_, stderr, status = run(way, "git-upload-pack 'nothing.git'")
+		Expect(status).To(Equal(1))
+		Expect(stderr).To(ContainSubstring("Repository not found"))
+	})
+})
@@ -0,0 +1,146 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/coreos/go-oidc"
+	"github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/user"
+	"golang.org/x/oauth2"
+	"regexp"
+	"strings"
+)
+
+// Provider signs users in through an OpenID Connect provider with the authorization code flow and PKCE.
+type Provider struct {
+	config   config.Config
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Identity is what the provider told about the user.
+type Identity struct {
+	Subject, Name, Email string
+}
+
+// New discovers the provider configured in c, nil means single sign-on is disabled.
+func New(ctx context.Context, c config.Config) (*Provider, error) {
+	if len(c.OIDC.Issuer) < 1 {
+		return nil, nil
+	}
+	p, err := oidc.NewProvider(ctx, c.OIDC.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{
+		config: c,
+		oauth2: oauth2.Config{
+			ClientID:     c.OIDC.ClientId,
+			ClientSecret: c.OIDC.ClientSecret,
+			RedirectURL:  c.OIDC.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       c.OIDC.Scopes,
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: c.OIDC.ClientId}),
+	}, nil
+}
+
+// AuthCodeURL returns where to send the user, codeVerifier must be kept until Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	return p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", challenge(codeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+}
+
+// Exchange redeems the authorization code and verifies the id token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if ok == false {
+		return nil, fmt.Errorf("id_token is missing")
+	}
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("nonce does not match")
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	id := &Identity{Subject: p.config.OIDC.Issuer + "#" + idToken.Subject}
+	id.Name, _ = claims[p.config.OIDC.NameClaim].(string)
+	id.Email, _ = claims[p.config.OIDC.EmailClaim].(string)
+	if len(id.Name) < 1 {
+		return nil, fmt.Errorf("%s claim is missing", p.config.OIDC.NameClaim)
+	}
+	return id, nil
+}
+
+var invalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Map returns the gotive user of id, the user is made at the first login.
+// An existing local user of the same name is never taken over.
+func Map(users user.Users, id *Identity) (*user.User, error) {
+	if u, err := users.FindBySubject(id.Subject); err == nil {
+		if u.Email != id.Email && 0 < len(id.Email) {
+			return users.Update(u.Name, func(u *user.User) error {
+				u.Email = id.Email
+				return nil
+			})
+		}
+		return u, nil
+	} else if err != user.UserNotFound {
+		return nil, err
+	}
+
+	name := strings.Trim(invalidChars.ReplaceAllString(strings.SplitN(id.Name, "@", 2)[0], "-"), "-_")
+	if user.ValidName(name) == false {
+		return nil, fmt.Errorf("Unsupported user name %s", id.Name)
+	}
+	u := &user.User{Name: name, Email: id.Email, Subject: id.Subject}
+	if err := users.Create(u); err == user.UserExists {
+		return nil, fmt.Errorf("%s is already taken by another user", name)
+	} else if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Random returns an unguessable string for state, nonce and code verifier.
+func Random() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func challenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sso_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/sso"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+)
+
+var _ = Describe("Map", func() {
+	var (
+		us   user.Users
+		root string
+	)
+	BeforeEach(func() {
+		c := config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "sso")
+		Expect(err).To(BeNil())
+		root = p
+		c.Users = p
+		us = user.New(c)
+	})
+	AfterEach(func() {
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	It("make a user at the first login", func() {
+		id := &Identity{Subject: "https://idp.example.com#1234", Name: "way@example.com", Email: "way@example.com"}
+		u, err := Map(us, id)
+		Expect(err).To(BeNil())
+		Expect(u.Name).To(Equal("way"))
+		Expect(u.Subject).To(Equal(id.Subject))
+
+		found, err := us.FindBySubject(id.Subject)
+		Expect(err).To(BeNil())
+		Expect(found.Name).To(Equal("way"))
+	})
+
+	It("find the user by subject and follow the email", func() {
+		id := &Identity{Subject: "https://idp.example.com#1234", Name: "way", Email: "way@example.com"}
+		_, err := Map(us, id)
+		Expect(err).To(BeNil())
+
+		id.Name, id.Email = "renamed", "new@example.com"
+		u, err := Map(us, id)
+		Expect(err).To(BeNil())
+		Expect(u.Name).To(Equal("way"))
+		Expect(u.Email).To(Equal("new@example.com"))
+	})
+
+	It("never take over a local user", func() {
+		Expect(us.Save(&user.User{Name: "way", Email: "way@example.com"})).To(BeNil())
+		_, err := Map(us, &Identity{Subject: "https://idp.example.com#1234", Name: "way"})
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("make unguessable values", func() {
+		Expect(Random()).NotTo(Equal(Random()))
+		Expect(len(Random())).To(Equal(43))
+	})
+})
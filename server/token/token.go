@@ -0,0 +1,226 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	c "github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	Read  = "gist:read"
+	Write = "gist:write"
+	Admin = "admin"
+)
+
+// Scopes lists every scope a token may carry.
+var Scopes = []string{Read, Write, Admin}
+
+// prefix marks secrets as tokens, so they are told apart from passwords.
+const prefix = "gotive_"
+
+// Token is a credential of a user limited to its scopes, only the hash of the secret is stored.
+type Token struct {
+	Id      string    `json:"id"`
+	User    string    `json:"user"`
+	Note    string    `json:"note"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+	// Expires is zero when the token never expires.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (t *Token) Expired(now time.Time) bool {
+	return t.Expires.IsZero() == false && t.Expires.Before(now)
+}
+
+// Allows reports whether the token grants scope, gist:write includes gist:read and admin includes both.
+func (t *Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || (s == Write && scope == Read) || s == Admin {
+			return true
+		}
+	}
+	return false
+}
+
+type Tokens interface {
+	// Mint makes a token and returns its secret, which is shown to the user only once.
+	Mint(u *user.User, note string, scopes []string, expires time.Time) (string, *Token, error)
+	List(name string) ([]*Token, error)
+	Revoke(name, id string) error
+	Authenticate(secret string) (*user.User, *Token, error)
+}
+
+var TokenNotFound = fmt.Errorf("Token not found")
+
+// IsToken reports whether s looks like a token secret rather than a password.
+func IsToken(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+type gotiveTokens struct {
+	config c.Config
+}
+
+func New(c c.Config) Tokens {
+	if err := os.MkdirAll(c.Tokens, 0700); err != nil {
+		panic(err)
+	}
+	return &gotiveTokens{config: c}
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// path of a token is named by the hash of its secret, the id is the head of the hash.
+func (ts *gotiveTokens) path(hash string) string {
+	return filepath.Join(ts.config.Tokens, hash+".json")
+}
+
+func (ts *gotiveTokens) Mint(u *user.User, note string, scopes []string, expires time.Time) (string, *Token, error) {
+	if len(scopes) < 1 {
+		return "", nil, fmt.Errorf("Token needs at least one scope")
+	}
+	for _, s := range scopes {
+		switch s {
+		case Read, Write:
+		case Admin:
+			if u.HasRole(user.AdminRole) == false {
+				return "", nil, fmt.Errorf("%s scope requires the admin role", Admin)
+			}
+		default:
+			return "", nil, fmt.Errorf("Unknown scope %s", s)
+		}
+	}
+	now := time.Now()
+	if expires.IsZero() == false && expires.Before(now) {
+		return "", nil, fmt.Errorf("Token is already expired")
+	}
+
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := prefix + hex.EncodeToString(b)
+	h := hash(secret)
+	t := &Token{Id: h[:12], User: u.Name, Note: note, Scopes: scopes, Created: now, Expires: expires}
+	j, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	// write then rename, so readers never see a half written file.
+	p := ts.path(h)
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, j, 0600); err != nil {
+		return "", nil, err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return "", nil, err
+	}
+	return secret, t, nil
+}
+
+func (ts *gotiveTokens) read(p string) (*Token, error) {
+	if osutil.IsExist(p) == false {
+		return nil, TokenNotFound
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	t := &Token{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (ts *gotiveTokens) List(name string) ([]*Token, error) {
+	files, err := filepath.Glob(filepath.Join(ts.config.Tokens, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	tokens := []*Token{}
+	for _, f := range files {
+		t, err := ts.read(f)
+		if err != nil {
+			continue
+		}
+		if t.User == name {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Sort(byCreated(tokens))
+	return tokens, nil
+}
+
+type byCreated []*Token
+
+func (b byCreated) Len() int           { return len(b) }
+func (b byCreated) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byCreated) Less(i, j int) bool { return b[j].Created.Before(b[i].Created) }
+
+var validId = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+func (ts *gotiveTokens) Revoke(name, id string) error {
+	if validId.MatchString(id) == false {
+		return TokenNotFound
+	}
+	files, err := filepath.Glob(filepath.Join(ts.config.Tokens, id+"*.json"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if t, err := ts.read(f); err == nil && t.User == name {
+			return os.Remove(f)
+		}
+	}
+	return TokenNotFound
+}
+
+func (ts *gotiveTokens) Authenticate(secret string) (*user.User, *Token, error) {
+	if IsToken(secret) == false {
+		return nil, nil, user.FailToAuthenticate
+	}
+	t, err := ts.read(ts.path(hash(secret)))
+	if err != nil {
+		return nil, nil, user.FailToAuthenticate
+	}
+	if t.Expired(time.Now()) {
+		return nil, nil, user.FailToAuthenticate
+	}
+	u, err := user.New(ts.config).Find(t.User)
+	if err != nil {
+		return nil, nil, user.FailToAuthenticate
+	}
+	return u, t, nil
+}
@@ -0,0 +1,134 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package token_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/token"
+	"github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Tokens", func() {
+	var (
+		c    config.Config
+		ts   Tokens
+		u    *user.User
+		root string
+	)
+	BeforeEach(func() {
+		c = config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "tokens")
+		Expect(err).To(BeNil())
+		root = p
+		c.Users = filepath.Join(p, "users")
+		c.Tokens = filepath.Join(p, "tokens")
+		u = &user.User{Name: "way", Email: "way@example.com"}
+		Expect(user.New(c).Save(u)).To(BeNil())
+		ts = New(c)
+	})
+	AfterEach(func() {
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	It("mint and authenticate normally", func() {
+		secret, t, err := ts.Mint(u, "ci", []string{Write}, time.Time{})
+		Expect(err).To(BeNil())
+		Expect(IsToken(secret)).To(BeTrue())
+		Expect(t.Allows(Read)).To(BeTrue())
+		Expect(t.Allows(Write)).To(BeTrue())
+		Expect(t.Allows(Admin)).To(BeFalse())
+
+		found, ft, err := ts.Authenticate(secret)
+		Expect(err).To(BeNil())
+		Expect(found.Name).To(Equal("way"))
+		Expect(ft.Id).To(Equal(t.Id))
+	})
+
+	It("store only the hash", func() {
+		secret, _, err := ts.Mint(u, "ci", []string{Read}, time.Time{})
+		Expect(err).To(BeNil())
+		files, err := filepath.Glob(filepath.Join(c.Tokens, "*"))
+		Expect(err).To(BeNil())
+		Expect(files).To(HaveLen(1))
+		b, err := ioutil.ReadFile(files[0])
+		Expect(err).To(BeNil())
+		Expect(strings.Contains(string(b), secret)).To(BeFalse())
+		Expect(strings.Contains(files[0], secret)).To(BeFalse())
+	})
+
+	It("reject wrong and expired tokens", func() {
+		_, _, err := ts.Authenticate("gotive_0000")
+		Expect(err).To(Equal(user.FailToAuthenticate))
+
+		secret, t, err := ts.Mint(u, "ci", []string{Read}, time.Now().Add(time.Hour))
+		Expect(err).To(BeNil())
+		Expect(t.Expired(time.Now())).To(BeFalse())
+		Expect(t.Expired(time.Now().Add(2 * time.Hour))).To(BeTrue())
+		_, _, err = ts.Authenticate(secret)
+		Expect(err).To(BeNil())
+
+		_, _, err = ts.Mint(u, "ci", []string{Read}, time.Now().Add(-time.Hour))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("validate scopes", func() {
+		_, _, err := ts.Mint(u, "none", []string{}, time.Time{})
+		Expect(err).NotTo(BeNil())
+		_, _, err = ts.Mint(u, "unknown", []string{"repo"}, time.Time{})
+		Expect(err).NotTo(BeNil())
+		_, _, err = ts.Mint(u, "admin", []string{Admin}, time.Time{})
+		Expect(err).NotTo(BeNil())
+
+		u.Roles = []string{user.AdminRole}
+		_, t, err := ts.Mint(u, "admin", []string{Admin}, time.Time{})
+		Expect(err).To(BeNil())
+		Expect(t.Allows(Read)).To(BeTrue())
+		Expect(t.Allows(Write)).To(BeTrue())
+		Expect(t.Allows(Admin)).To(BeTrue())
+	})
+
+	It("list and revoke tokens of the user", func() {
+		secret, t, err := ts.Mint(u, "first", []string{Read}, time.Time{})
+		Expect(err).To(BeNil())
+		_, _, err = ts.Mint(u, "second", []string{Write}, time.Time{})
+		Expect(err).To(BeNil())
+		_, _, err = ts.Mint(&user.User{Name: "other"}, "other", []string{Write}, time.Time{})
+		Expect(err).To(BeNil())
+
+		list, err := ts.List("way")
+		Expect(err).To(BeNil())
+		Expect(list).To(HaveLen(2))
+		Expect(list[0].Note).To(Equal("second"))
+
+		Expect(ts.Revoke("other", t.Id)).To(Equal(TokenNotFound))
+		Expect(ts.Revoke("way", t.Id)).To(BeNil())
+		Expect(ts.Revoke("way", t.Id)).To(Equal(TokenNotFound))
+		_, _, err = ts.Authenticate(secret)
+		Expect(err).To(Equal(user.FailToAuthenticate))
+
+		list, err = ts.List("way")
+		Expect(err).To(BeNil())
+		Expect(list).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,513 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	c "github.com/taichi/gotive/config"
+	"github.com/taichi/gotive/log"
+	"github.com/taichi/osutil"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type User struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Keys     []string `json:"keys,omitempty"`
+	Stars    []string `json:"stars,omitempty"`
+	// Subject identifies the user at the single sign-on provider as issuer#sub.
+	Subject string `json:"subject,omitempty"`
+	// Groups and Roles come from the directory server at each login.
+	Groups []string `json:"groups,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+type Users interface {
+	Find(name string) (*User, error)
+	FindByKey(key ssh.PublicKey) (*User, error)
+	FindBySubject(subject string) (*User, error)
+	Save(u *User) error
+	// Create saves u only if nobody has its name yet.
+	Create(u *User) error
+	// Update finds the user of name, changes it by fn and saves it, while no other change of the user runs.
+	Update(name string, fn func(u *User) error) (*User, error)
+	Authenticate(name, password string) (*User, error)
+}
+
+var UserNotFound = fmt.Errorf("User not found")
+var FailToAuthenticate = fmt.Errorf("Fail to authenticate")
+var KeyInUse = fmt.Errorf("Key is registered to another user")
+var UserExists = fmt.Errorf("User already exists")
+
+// AdminRole is the role of users who administer gotive, it comes from the directory server.
+const AdminRole = "admin"
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,38}$`)
+
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPassword stores the bcrypt hash of password, the plain text is never kept.
+func (u *User) SetPassword(password string) error {
+	if len(password) < 1 {
+		return fmt.Errorf("Empty password")
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.Password = string(b)
+	return nil
+}
+
+func (u *User) MatchPassword(password string) bool {
+	if len(u.Password) < 1 {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// AddKey registers a public key written in the authorized_keys format.
+func (u *User) AddKey(authorizedKey []byte) error {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey(authorizedKey)
+	if err != nil {
+		return err
+	}
+	if u.HasKey(key) {
+		return fmt.Errorf("Already registered %s", ssh.FingerprintSHA256(key))
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if 0 < len(comment) {
+		line += " " + comment
+	}
+	u.Keys = append(u.Keys, line)
+	return nil
+}
+
+func (u *User) HasKey(key ssh.PublicKey) bool {
+	marshaled := string(key.Marshal())
+	for _, k := range u.Keys {
+		if pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k)); err == nil && string(pk.Marshal()) == marshaled {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) Starred(id string) bool {
+	for _, s := range u.Stars {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) Star(id string) {
+	if u.Starred(id) == false {
+		u.Stars = append(u.Stars, id)
+	}
+}
+
+func (u *User) Unstar(id string) {
+	stars := []string{}
+	for _, s := range u.Stars {
+		if s != id {
+			stars = append(stars, s)
+		}
+	}
+	u.Stars = stars
+}
+
+type gotiveUsers struct {
+	config c.Config
+}
+
+// lock serializes the changes of a user, counted by the holders and the waiters.
+type lock struct {
+	sync.Mutex
+	refs int
+}
+
+var (
+	mutex sync.Mutex
+	locks = map[string]*lock{}
+)
+
+// locked runs fn while it holds the lock of the user of name.
+func locked(name string, fn func() error) error {
+	mutex.Lock()
+	l, ok := locks[name]
+	if ok == false {
+		l = &lock{}
+		locks[name] = l
+	}
+	l.refs++
+	mutex.Unlock()
+
+	l.Lock()
+	defer func() {
+		l.Unlock()
+		mutex.Lock()
+		if l.refs--; l.refs < 1 {
+			delete(locks, name)
+		}
+		mutex.Unlock()
+	}()
+	return fn()
+}
+
+func New(c c.Config) Users {
+	if err := os.MkdirAll(c.Users, 0700); err != nil {
+		panic(err)
+	}
+	us := &gotiveUsers{config: c}
+	if osutil.IsExist(us.keysDir()) == false {
+		if err := us.indexKeys(); err != nil {
+			panic(err)
+		}
+	}
+	return us
+}
+
+func (us *gotiveUsers) path(name string) (string, error) {
+	if ValidName(name) == false {
+		return "", fmt.Errorf("Unsupported user name %s", name)
+	}
+	return filepath.Join(us.config.Users, name+".json"), nil
+}
+
+func (us *gotiveUsers) Find(name string) (*User, error) {
+	p, err := us.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if osutil.IsExist(p) == false {
+		return nil, UserNotFound
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	u := &User{}
+	if err := json.Unmarshal(b, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// FindByKey looks the key up in the key index, which maps fingerprints to the users who hold them.
+func (us *gotiveUsers) FindByKey(key ssh.PublicKey) (*User, error) {
+	holders, err := us.holders(us.keyPath(key))
+	if err != nil {
+		return nil, err
+	}
+	// a key which several users held before the index existed authenticates nobody.
+	if len(holders) != 1 {
+		return nil, UserNotFound
+	}
+	u, err := us.Find(holders[0])
+	if err != nil {
+		return nil, err
+	}
+	// the index may be left behind by an interrupted save.
+	if u.HasKey(key) == false {
+		return nil, UserNotFound
+	}
+	return u, nil
+}
+
+func (us *gotiveUsers) FindBySubject(subject string) (*User, error) {
+	return us.findBy(func(u *User) bool { return 0 < len(u.Subject) && u.Subject == subject })
+}
+
+func (us *gotiveUsers) findBy(fn func(u *User) bool) (*User, error) {
+	files, err := filepath.Glob(filepath.Join(us.config.Users, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		u, err := us.Find(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			continue
+		}
+		if fn(u) {
+			return u, nil
+		}
+	}
+	return nil, UserNotFound
+}
+
+// Save writes u, its keys are claimed in the key index first and a key of another user is refused.
+func (us *gotiveUsers) Save(u *User) error {
+	return locked(u.Name, func() error { return us.write(u, false) })
+}
+
+func (us *gotiveUsers) Create(u *User) error {
+	return locked(u.Name, func() error { return us.write(u, true) })
+}
+
+func (us *gotiveUsers) Update(name string, fn func(u *User) error) (*User, error) {
+	var u *User
+	err := locked(name, func() error {
+		found, err := us.Find(name)
+		if err != nil {
+			return err
+		}
+		if err := fn(found); err != nil {
+			return err
+		}
+		u = found
+		return us.write(u, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (us *gotiveUsers) write(u *User, create bool) error {
+	p, err := us.path(u.Name)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+	old, err := us.Find(u.Name)
+	if err != nil && err != UserNotFound {
+		return err
+	} else if create && old != nil {
+		return UserExists
+	}
+	claimed, err := us.claimKeys(u)
+	if err != nil {
+		return err
+	}
+	if err := us.replace(p, b, create); err != nil {
+		us.releaseKeys(u.Name, claimed)
+		return err
+	}
+	if old != nil {
+		us.releaseKeys(u.Name, droppedKeys(old, u))
+	}
+	return nil
+}
+
+// replace writes a temporary file then renames it to p, so readers never see a half written file.
+// For create, it is linked instead, which fails when p exists even if another writer races.
+func (us *gotiveUsers) replace(p string, b []byte, create bool) error {
+	f, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(b)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if create == false {
+		return os.Rename(tmp, p)
+	}
+	err = os.Link(tmp, p)
+	if os.IsExist(err) {
+		return UserExists
+	}
+	return err
+}
+
+func (us *gotiveUsers) keysDir() string {
+	return filepath.Join(us.config.Users, "keys")
+}
+
+func (us *gotiveUsers) keyPath(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return filepath.Join(us.keysDir(), hex.EncodeToString(sum[:]))
+}
+
+// claimKeys records u as the holder of its keys which nobody holds yet, and returns them.
+func (us *gotiveUsers) claimKeys(u *User) ([]ssh.PublicKey, error) {
+	claimed := []ssh.PublicKey{}
+	for _, k := range u.Keys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+		if err != nil {
+			us.releaseKeys(u.Name, claimed)
+			return nil, err
+		}
+		ok, err := us.claimKey(u.Name, key)
+		if err != nil {
+			us.releaseKeys(u.Name, claimed)
+			return nil, err
+		}
+		if ok {
+			claimed = append(claimed, key)
+		}
+	}
+	return claimed, nil
+}
+
+// claimKey reports whether the key is newly claimed for name, the key of another user is refused
+// unless that user no longer has it.
+func (us *gotiveUsers) claimKey(name string, key ssh.PublicKey) (bool, error) {
+	p := us.keyPath(key)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		_, err = f.WriteString(name)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		return err == nil, err
+	}
+	if os.IsExist(err) == false {
+		return false, err
+	}
+	holders, err := us.holders(p)
+	if err != nil {
+		return false, err
+	}
+	if len(holders) == 1 && holders[0] == name {
+		return false, nil
+	}
+	for _, holder := range holders {
+		if holder == name {
+			continue
+		}
+		if h, err := us.Find(holder); err == nil && h.HasKey(key) {
+			return false, KeyInUse
+		}
+	}
+	return true, ioutil.WriteFile(p, []byte(name), 0600)
+}
+
+// holders returns the users in the index entry at p, one per line.
+func (us *gotiveUsers) holders(p string) ([]string, error) {
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// releaseKeys removes name from the index entries of keys.
+func (us *gotiveUsers) releaseKeys(name string, keys []ssh.PublicKey) {
+	for _, key := range keys {
+		p := us.keyPath(key)
+		holders, err := us.holders(p)
+		if err != nil {
+			continue
+		}
+		rest := []string{}
+		for _, h := range holders {
+			if h != name {
+				rest = append(rest, h)
+			}
+		}
+		if len(rest) < 1 {
+			os.Remove(p)
+		} else if len(rest) < len(holders) {
+			ioutil.WriteFile(p, []byte(strings.Join(rest, "\n")), 0600)
+		}
+	}
+}
+
+func droppedKeys(old, u *User) []ssh.PublicKey {
+	dropped := []ssh.PublicKey{}
+	for _, k := range old.Keys {
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k)); err == nil && u.HasKey(key) == false {
+			dropped = append(dropped, key)
+		}
+	}
+	return dropped
+}
+
+// indexKeys builds the key index from every user. A key which several users hold is recorded
+// with all of them, it authenticates nobody until all but one of them remove it.
+func (us *gotiveUsers) indexKeys() error {
+	files, err := filepath.Glob(filepath.Join(us.config.Users, "*.json"))
+	if err != nil {
+		return err
+	}
+	holders := map[string][]string{}
+	keys := map[string]ssh.PublicKey{}
+	for _, f := range files {
+		u, err := us.Find(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			continue
+		}
+		for _, k := range u.Keys {
+			if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k)); err == nil {
+				p := us.keyPath(key)
+				holders[p] = append(holders[p], u.Name)
+				keys[p] = key
+			}
+		}
+	}
+	if err := os.MkdirAll(us.keysDir(), 0700); err != nil {
+		return err
+	}
+	for p, names := range holders {
+		if 1 < len(names) {
+			log.Warnf("%s is registered to %s, it is disabled", ssh.FingerprintSHA256(keys[p]), strings.Join(names, ", "))
+		}
+		if err := ioutil.WriteFile(p, []byte(strings.Join(names, "\n")), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dummyHash is compared when there is no password to compare, so the time never tells whether a name exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("gotive"), bcrypt.DefaultCost)
+
+func (us *gotiveUsers) Authenticate(name, password string) (*User, error) {
+	u, err := us.Find(name)
+	if err != nil || len(u.Password) < 1 {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, FailToAuthenticate
+	}
+	if u.MatchPassword(password) == false {
+		return nil, FailToAuthenticate
+	}
+	return u, nil
+}
@@ -0,0 +1,218 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package user_test
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/taichi/gotive/config"
+	. "github.com/taichi/gotive/server/user"
+	"github.com/taichi/osutil"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var _ = Describe("Users", func() {
+	var (
+		c    config.Config
+		us   Users
+		root string
+	)
+	BeforeEach(func() {
+		c = config.New()
+		p, err := ioutil.TempDir(os.TempDir(), "users")
+		Expect(err).To(BeNil())
+		root = p
+		c.Users = p
+		us = New(c)
+	})
+	AfterEach(func() {
+		Expect(osutil.ForceRemoveAll(root)).To(BeNil())
+	})
+
+	It("save and find normally", func() {
+		u := &User{Name: "way", Email: "wayway@example.com"}
+		Expect(u.SetPassword("secret")).To(BeNil())
+		Expect(u.Password).NotTo(Equal("secret"))
+		Expect(us.Save(u)).To(BeNil())
+
+		found, err := us.Find("way")
+		Expect(err).To(BeNil())
+		Expect(found).To(Equal(u))
+	})
+
+	It("create only new users", func() {
+		Expect(us.Create(&User{Name: "way", Email: "first@example.com"})).To(BeNil())
+		Expect(us.Create(&User{Name: "way", Email: "second@example.com"})).To(Equal(UserExists))
+		found, err := us.Find("way")
+		Expect(err).To(BeNil())
+		Expect(found.Email).To(Equal("first@example.com"))
+	})
+
+	It("let one of racing creations win", func() {
+		errs := make(chan error)
+		for i := 0; i < 10; i++ {
+			go func(i int) {
+				errs <- us.Create(&User{Name: "way", Email: fmt.Sprintf("%d@example.com", i)})
+			}(i)
+		}
+		created := 0
+		for i := 0; i < 10; i++ {
+			if err := <-errs; err == nil {
+				created++
+			} else {
+				Expect(err).To(Equal(UserExists))
+			}
+		}
+		Expect(created).To(Equal(1))
+		files, err := ioutil.ReadDir(root)
+		Expect(err).To(BeNil())
+		names := []string{}
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		Expect(names).To(Equal([]string{"keys", "way.json"}))
+	})
+
+	It("authenticate normally", func() {
+		u := &User{Name: "way", Email: "wayway@example.com"}
+		Expect(u.SetPassword("secret")).To(BeNil())
+		Expect(us.Save(u)).To(BeNil())
+
+		found, err := us.Authenticate("way", "secret")
+		Expect(err).To(BeNil())
+		Expect(found.Name).To(Equal("way"))
+
+		_, err = us.Authenticate("way", "wrong")
+		Expect(err).To(Equal(FailToAuthenticate))
+		_, err = us.Authenticate("nobody", "secret")
+		Expect(err).To(Equal(FailToAuthenticate))
+	})
+
+	It("find by public key normally", func() {
+		key := []byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOQcgE5UjMJnPGyvmmVxV4i1P2GQTOftcrKu8vGdGEhv way@example")
+		u := &User{Name: "way", Email: "wayway@example.com"}
+		Expect(u.AddKey(key)).To(BeNil())
+		Expect(u.AddKey(key)).NotTo(BeNil())
+		Expect(us.Save(u)).To(BeNil())
+		Expect(us.Save(&User{Name: "other"})).To(BeNil())
+
+		pk, _, _, _, err := ssh.ParseAuthorizedKey(key)
+		Expect(err).To(BeNil())
+		found, err := us.FindByKey(pk)
+		Expect(err).To(BeNil())
+		Expect(found.Name).To(Equal("way"))
+		Expect(found.Keys).To(Equal([]string{string(key)}))
+	})
+
+	It("refuse a key which another user holds", func() {
+		key := []byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOQcgE5UjMJnPGyvmmVxV4i1P2GQTOftcrKu8vGdGEhv way@example")
+		pk, _, _, _, err := ssh.ParseAuthorizedKey(key)
+		Expect(err).To(BeNil())
+		u := &User{Name: "way"}
+		Expect(u.AddKey(key)).To(BeNil())
+		Expect(us.Save(u)).To(BeNil())
+
+		other := &User{Name: "other"}
+		Expect(other.AddKey(key)).To(BeNil())
+		Expect(us.Save(other)).To(Equal(KeyInUse))
+		_, err = us.Find("other")
+		Expect(err).To(Equal(UserNotFound))
+
+		// the key is free again once its holder removes it.
+		u.Keys = nil
+		Expect(us.Save(u)).To(BeNil())
+		_, err = us.FindByKey(pk)
+		Expect(err).To(Equal(UserNotFound))
+		Expect(us.Save(other)).To(BeNil())
+		found, err := us.FindByKey(pk)
+		Expect(err).To(BeNil())
+		Expect(found.Name).To(Equal("other"))
+	})
+
+	It("disable keys which several users held before the index", func() {
+		key := []byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOQcgE5UjMJnPGyvmmVxV4i1P2GQTOftcrKu8vGdGEhv way@example")
+		pk, _, _, _, err := ssh.ParseAuthorizedKey(key)
+		Expect(err).To(BeNil())
+		for _, name := range []string{"way", "other"} {
+			b, err := json.Marshal(&User{Name: name, Keys: []string{string(key)}})
+			Expect(err).To(BeNil())
+			Expect(ioutil.WriteFile(filepath.Join(root, name+".json"), b, 0600)).To(BeNil())
+		}
+		Expect(os.RemoveAll(filepath.Join(root, "keys"))).To(BeNil())
+		us = New(c)
+
+		_, err = us.FindByKey(pk)
+		Expect(err).To(Equal(UserNotFound))
+
+		u, err := us.Find("other")
+		Expect(err).To(BeNil())
+		u.Keys = nil
+		Expect(us.Save(u)).To(BeNil())
+		found, err := us.FindByKey(pk)
+		Expect(err).To(BeNil())
+		Expect(found.Name).To(Equal("way"))
+	})
+
+	It("star and unstar normally", func() {
+		u := &User{Name: "way"}
+		u.Star("hoge")
+		u.Star("hoge")
+		u.Star("moge")
+		Expect(u.Stars).To(Equal([]string{"hoge", "moge"}))
+		Expect(u.Starred("hoge")).To(BeTrue())
+		u.Unstar("hoge")
+		Expect(u.Starred("hoge")).To(BeFalse())
+		Expect(u.Stars).To(Equal([]string{"moge"}))
+	})
+
+	It("never lose concurrent updates", func() {
+		Expect(us.Create(&User{Name: "way"})).To(BeNil())
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(id string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := us.Update("way", func(u *User) error {
+					u.Star(id)
+					return nil
+				})
+				Expect(err).To(BeNil())
+			}(fmt.Sprintf("gist%d", i))
+		}
+		wg.Wait()
+		u, err := us.Find("way")
+		Expect(err).To(BeNil())
+		Expect(u.Stars).To(HaveLen(20))
+
+		_, err = us.Update("nobody", func(u *User) error { return nil })
+		Expect(err).To(Equal(UserNotFound))
+	})
+
+	It("should reject unsupported names", func() {
+		_, err := us.Find("../way")
+		Expect(err).NotTo(BeNil())
+		Expect(us.Save(&User{Name: "../way"})).NotTo(BeNil())
+		_, err = us.Find("nobody")
+		Expect(err).To(Equal(UserNotFound))
+	})
+})